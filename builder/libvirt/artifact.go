@@ -2,6 +2,7 @@ package libvirt
 
 import (
 	"fmt"
+	"log"
 
 	"github.com/digitalocean/go-libvirt"
 	"libvirt.org/go/libvirtxml"
@@ -12,6 +13,10 @@ type Artifact struct {
 	volumeRef     libvirt.StorageVol
 	driver        *libvirt.Libvirt
 	generatedData map[string]interface{}
+	// The volume existed before the build and was reused by it
+	reused bool
+	// The UUID of the libvirt secret the encrypted volume was created with, empty if it's not encrypted
+	encryptionSecretUUID string
 }
 
 // Returns the ID of the builder that was used to create this artifact.
@@ -71,6 +76,17 @@ func (artifact *Artifact) State(name string) interface{} {
 		return artifact.volumeDef.Target.Format.Type
 	case "RemotePath":
 		return artifact.volumeDef.Target.Path
+	case "Reused":
+		return artifact.reused
+	case "Encrypted":
+		return artifact.encryptionSecretUUID != ""
+	case "EncryptionFormat":
+		if artifact.volumeDef.Target != nil && artifact.volumeDef.Target.Encryption != nil {
+			return artifact.volumeDef.Target.Encryption.Format
+		}
+		return ""
+	case "EncryptionSecretUUID":
+		return artifact.encryptionSecretUUID
 	default:
 		if v, ok := artifact.generatedData[name]; ok {
 			return v
@@ -82,7 +98,12 @@ func (artifact *Artifact) State(name string) interface{} {
 // Destroy deletes the artifact. Packer calls this for various reasons,
 // such as if a post-processor has processed this artifact and it is
 // no longer needed.
+// A reused volume existed before the build, so it's left in place.
 func (artifact *Artifact) Destroy() error {
+	if artifact.reused {
+		log.Printf("Not deleting reused volume %s/%s\n", artifact.volumeRef.Pool, artifact.volumeRef.Name)
+		return nil
+	}
 	err := artifact.driver.StorageVolDelete(artifact.volumeRef, libvirt.StorageVolDeleteNormal)
 	return err
 }
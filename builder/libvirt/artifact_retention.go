@@ -0,0 +1,175 @@
+package libvirt
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	libvirt "github.com/digitalocean/go-libvirt"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/thomasklein94/packer-plugin-libvirt/builder/libvirt/volume"
+	"libvirt.org/go/libvirtxml"
+)
+
+type retentionCandidate struct {
+	ref      libvirt.StorageVol
+	modified time.Time
+}
+
+// applyArtifactRetention deletes older artifacts from the pool of the new artifact according to
+// the retention settings. Volumes still in use by a domain or as a backing store are kept.
+// The build already succeeded at this point, so problems are only reported, they don't fail the build.
+func applyArtifactRetention(ui packersdk.Ui, driver *libvirt.Libvirt, retention *ArtifactRetention, artifact *Artifact) {
+	if !retention.Enabled() {
+		return
+	}
+
+	ui.Say("Applying artifact retention...")
+
+	candidates, err := listRetentionCandidates(driver, retention, artifact)
+	if err != nil {
+		ui.Error(fmt.Sprintf("Couldn't list older artifacts: %s", err))
+		return
+	}
+
+	removed := []string{}
+
+	for _, candidate := range selectRetentionCandidates(retention, artifact.volumeRef.Name, candidates, time.Now()) {
+		name := fmt.Sprintf("%s/%s", candidate.ref.Pool, candidate.ref.Name)
+
+		users, err := volume.VolumeUsers(driver, candidate.ref)
+		if err != nil {
+			ui.Error(fmt.Sprintf("Couldn't check whether %s is in use, keeping it: %s", name, err))
+			continue
+		}
+		if len(users) > 0 {
+			ui.Message(fmt.Sprintf("Keeping %s, it's still used by %s", name, strings.Join(users, ", ")))
+			continue
+		}
+
+		if err := driver.StorageVolDelete(candidate.ref, libvirt.StorageVolDeleteNormal); err != nil {
+			ui.Error(fmt.Sprintf("Couldn't delete older artifact %s: %s", name, err))
+			continue
+		}
+
+		removed = append(removed, name)
+	}
+
+	if len(removed) == 0 {
+		ui.Message("No older artifact was removed")
+		return
+	}
+
+	ui.Message(fmt.Sprintf("Removed older artifacts:\n  %s", strings.Join(removed, "\n  ")))
+}
+
+// selectRetentionCandidates returns the older artifacts neither keep_last nor keep_younger_than keeps.
+// The new artifact is never among the candidates, but it counts towards keep_last if its name matches.
+func selectRetentionCandidates(retention *ArtifactRetention, artifactName string, candidates []retentionCandidate, now time.Time) []retentionCandidate {
+	sorted := make([]retentionCandidate, len(candidates))
+	copy(sorted, candidates)
+
+	// Most recently modified first
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].modified.After(sorted[j].modified)
+	})
+
+	kept := 0
+	if retention.matches(artifactName) {
+		kept++
+	}
+
+	selected := []retentionCandidate{}
+
+	for _, candidate := range sorted {
+		name := fmt.Sprintf("%s/%s", candidate.ref.Pool, candidate.ref.Name)
+
+		if retention.KeepLast > 0 && kept < retention.KeepLast {
+			log.Printf("Keeping %s, it's one of the last %d artifacts\n", name, retention.KeepLast)
+			kept++
+			continue
+		}
+
+		if retention.KeepYoungerThan > 0 && now.Sub(candidate.modified) < retention.KeepYoungerThan {
+			log.Printf("Keeping %s, it's younger than %s\n", name, retention.KeepYoungerThan)
+			continue
+		}
+
+		selected = append(selected, candidate)
+	}
+
+	return selected
+}
+
+func listRetentionCandidates(driver *libvirt.Libvirt, retention *ArtifactRetention, artifact *Artifact) ([]retentionCandidate, error) {
+	pool, err := driver.StoragePoolLookupByName(artifact.volumeRef.Pool)
+	if err != nil {
+		return nil, fmt.Errorf("StoragePoolLookupByName: %s", err)
+	}
+
+	// Pick up volumes created outside of libvirt, too
+	if err = driver.StoragePoolRefresh(pool, 0); err != nil {
+		log.Printf("Couldn't refresh storage pool %s: %s\n", pool.Name, err)
+	}
+
+	volumes, _, err := driver.StoragePoolListAllVolumes(pool, 1, 0)
+	if err != nil {
+		return nil, fmt.Errorf("StoragePoolListAllVolumes: %s", err)
+	}
+
+	candidates := []retentionCandidate{}
+
+	for _, vol := range volumes {
+		if vol.Name == artifact.volumeRef.Name || !retention.matches(vol.Name) {
+			continue
+		}
+
+		rawVolumeDef, err := driver.StorageVolGetXMLDesc(vol, 0)
+		if err != nil {
+			return nil, fmt.Errorf("StorageVolGetXMLDesc: %s", err)
+		}
+
+		volumeDef := &libvirtxml.StorageVolume{}
+		if err = volumeDef.Unmarshal(rawVolumeDef); err != nil {
+			return nil, fmt.Errorf("StorageVolUnmarshal: %s", err)
+		}
+
+		modified, ok := volumeModificationTime(volumeDef)
+		if !ok {
+			log.Printf("Volume %s/%s has no timestamps, skipping it\n", vol.Pool, vol.Name)
+			continue
+		}
+
+		candidates = append(candidates, retentionCandidate{ref: vol, modified: modified})
+	}
+
+	return candidates, nil
+}
+
+// volumeModificationTime parses the `seconds.nanoseconds` timestamps libvirt reports for file based volumes
+func volumeModificationTime(volumeDef *libvirtxml.StorageVolume) (time.Time, bool) {
+	if volumeDef.Target == nil || volumeDef.Target.Timestamps == nil {
+		return time.Time{}, false
+	}
+
+	raw := volumeDef.Target.Timestamps.Mtime
+	if raw == "" {
+		raw = volumeDef.Target.Timestamps.Ctime
+	}
+
+	parts := strings.SplitN(raw, ".", 2)
+	seconds, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	var nanoseconds int64
+	if len(parts) == 2 {
+		nanoseconds, _ = strconv.ParseInt(parts[1], 10, 64)
+	}
+
+	return time.Unix(seconds, nanoseconds), true
+}
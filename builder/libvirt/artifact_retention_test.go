@@ -0,0 +1,75 @@
+package libvirt
+
+import (
+	"testing"
+	"time"
+
+	libvirt "github.com/digitalocean/go-libvirt"
+)
+
+func TestSelectRetentionCandidates(t *testing.T) {
+	now := time.Date(2022, 5, 10, 12, 0, 0, 0, time.UTC)
+	candidates := []retentionCandidate{
+		{ref: libvirt.StorageVol{Pool: "default", Name: "image-3.qcow2"}, modified: now.Add(-3 * time.Hour)},
+		{ref: libvirt.StorageVol{Pool: "default", Name: "image-1.qcow2"}, modified: now.Add(-72 * time.Hour)},
+		{ref: libvirt.StorageVol{Pool: "default", Name: "image-2.qcow2"}, modified: now.Add(-48 * time.Hour)},
+	}
+
+	tests := []struct {
+		name         string
+		retention    ArtifactRetention
+		artifactName string
+		expected     []string
+	}{
+		{
+			name:         "matching artifact counts towards keep_last",
+			retention:    ArtifactRetention{NamePrefix: "image-", KeepLast: 2},
+			artifactName: "image-4.qcow2",
+			expected:     []string{"image-2.qcow2", "image-1.qcow2"},
+		},
+		{
+			name:         "artifact not matching doesn't count towards keep_last",
+			retention:    ArtifactRetention{NamePrefix: "image-", KeepLast: 2},
+			artifactName: "release.qcow2",
+			expected:     []string{"image-1.qcow2"},
+		},
+		{
+			name:         "keep_last of one keeps only the artifact",
+			retention:    ArtifactRetention{NamePrefix: "image-", KeepLast: 1},
+			artifactName: "image-4.qcow2",
+			expected:     []string{"image-3.qcow2", "image-2.qcow2", "image-1.qcow2"},
+		},
+		{
+			name:         "keep_younger_than",
+			retention:    ArtifactRetention{NamePrefix: "image-", KeepYoungerThan: 50 * time.Hour},
+			artifactName: "image-4.qcow2",
+			expected:     []string{"image-1.qcow2"},
+		},
+		{
+			name:         "keep_last and keep_younger_than both keep",
+			retention:    ArtifactRetention{NamePrefix: "image-", KeepLast: 2, KeepYoungerThan: 50 * time.Hour},
+			artifactName: "image-4.qcow2",
+			expected:     []string{"image-1.qcow2"},
+		},
+	}
+
+	for _, tt := range tests {
+		selected := selectRetentionCandidates(&tt.retention, tt.artifactName, candidates, now)
+
+		names := []string{}
+		for _, candidate := range selected {
+			names = append(names, candidate.ref.Name)
+		}
+
+		if len(names) != len(tt.expected) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, names)
+			continue
+		}
+		for i := range names {
+			if names[i] != tt.expected[i] {
+				t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, names)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package libvirt
+
+import (
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+)
+
+// bootTemplateData is available to the boot command and the kernel command line,
+// which are only rendered once the HTTP server is running
+type bootTemplateData struct {
+	HTTPIP   string
+	HTTPPort int
+	Name     string
+}
+
+// renderBootTemplate renders a template left alone while the configuration was decoded
+func renderBootTemplate(config *Config, state multistep.StateBag, tpl string) (string, error) {
+	data := &bootTemplateData{Name: config.DomainName}
+	if ip, ok := state.GetOk("http_ip"); ok {
+		data.HTTPIP = ip.(string)
+	}
+	if port, ok := state.GetOk("http_port"); ok {
+		data.HTTPPort = port.(int)
+	}
+
+	ctx := config.ctx
+	ctx.Data = data
+	return interpolate.Render(tpl, &ctx)
+}
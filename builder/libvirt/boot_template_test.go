@@ -0,0 +1,66 @@
+package libvirt
+
+import (
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"libvirt.org/go/libvirtxml"
+)
+
+func TestCmdlineIsRenderedAtRuntime(t *testing.T) {
+	config := Config{}
+	_, err := config.Prepare(map[string]interface{}{
+		"domain_name":  "kickstart",
+		"kernel":       "https://example.com/vmlinuz",
+		"cmdline":      "inst.ks=http://{{ .HTTPIP }}:{{ .HTTPPort }}/ks.cfg console=ttyS0",
+		"boot_command": []string{"<wait>{{ .Name }}<enter>"},
+		"communicator": map[string]interface{}{"communicator": "none"},
+		"volume": []map[string]interface{}{
+			{"alias": "artifact", "capacity": "1G"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Prepare: %s", err)
+	}
+
+	if config.DirectKernelBoot.Cmdline != "inst.ks=http://{{ .HTTPIP }}:{{ .HTTPPort }}/ks.cfg console=ttyS0" {
+		t.Fatalf("expected cmdline to be left for runtime, got %s", config.DirectKernelBoot.Cmdline)
+	}
+
+	state := new(multistep.BasicStateBag)
+	state.Put("http_ip", "192.168.122.1")
+	state.Put("http_port", 8080)
+
+	cmdline, err := renderBootTemplate(&config, state, config.DirectKernelBoot.Cmdline)
+	if err != nil {
+		t.Fatalf("renderBootTemplate: %s", err)
+	}
+	if cmdline != "inst.ks=http://192.168.122.1:8080/ks.cfg console=ttyS0" {
+		t.Errorf("unexpected cmdline: %s", cmdline)
+	}
+
+	bootCommand, err := renderBootTemplate(&config, state, config.BootConfig.BootCommand[0])
+	if err != nil {
+		t.Fatalf("renderBootTemplate: %s", err)
+	}
+	if bootCommand != "<wait>kickstart<enter>" {
+		t.Errorf("unexpected boot command: %s", bootCommand)
+	}
+}
+
+func TestNetworkHostIP(t *testing.T) {
+	networkDef := &libvirtxml.Network{
+		IPs: []libvirtxml.NetworkIP{
+			{Address: "fd00::1", Family: "ipv6"},
+			{Address: "192.168.122.1"},
+		},
+	}
+
+	if ip := networkHostIP(networkDef); ip != "192.168.122.1" {
+		t.Errorf("expected the IPv4 address, got %s", ip)
+	}
+
+	if ip := networkHostIP(&libvirtxml.Network{}); ip != "" {
+		t.Errorf("expected no address, got %s", ip)
+	}
+}
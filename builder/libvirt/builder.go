@@ -31,7 +31,12 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, []string, error) {
 func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook) (packersdk.Artifact, error) {
 	var artifact *Artifact = nil
 
-	driver, err := libvirtutils.ConnectByUriString(b.config.LibvirtURI)
+	uri := libvirtutils.LibvirtUri{}
+	if err := uri.Unmarshal(b.config.LibvirtURI); err != nil {
+		return nil, err
+	}
+
+	driver, dialer, err := libvirtutils.Connect(uri)
 	if err != nil {
 		return nil, err
 	}
@@ -47,12 +52,26 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 	state.Put("hook", hook)
 	state.Put("ui", ui)
 
+	// Available when libvirt is reached over SSH
+	if shell, ok := dialer.(libvirtutils.RemoteShell); ok {
+		state.Put("remote_shell", shell)
+	}
+
 	steps := []multistep.Step{}
 	steps = append(steps,
+		&stepCheckFirmware{},
+		&stepResolveDomainConflict{},
+		&stepCreatePools{},
+		commonsteps.HTTPServerFromHTTPConfig(&b.config.HTTPConfig),
+		&stepCreatePxeNetwork{},
+		&stepHTTPIPDiscover{},
+		&stepCheckPoolCapacity{},
 		&stepPrepareVolumes{},
+		&stepUploadNvramTemplate{},
 		&stepDefineDomain{},
 		&stepStartDomain{},
 		&stepTypeBootCommand{},
+		&stepEjectInstallMedia{},
 	)
 
 	switch b.config.Communicator.Type {
@@ -74,6 +93,7 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 	steps = append(steps,
 		&commonsteps.StepProvision{},
 		&stepShutdownDomain{},
+		&stepCommitInPlaceUpdates{},
 	)
 
 	// Run
@@ -97,6 +117,8 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 	if _, ok := state.GetOk("artifact"); ok {
 		artifact = state.Get("artifact").(*Artifact)
 		artifact.generatedData = map[string]interface{}{}
+
+		applyArtifactRetention(ui, driver, &b.config.ArtifactRetention, artifact)
 	}
 
 	return artifact, nil
@@ -9,12 +9,14 @@ import (
 	"github.com/digitalocean/go-libvirt"
 	"github.com/hashicorp/packer-plugin-sdk/common"
 	"github.com/hashicorp/packer-plugin-sdk/communicator"
+	"github.com/hashicorp/packer-plugin-sdk/multistep/commonsteps"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/hashicorp/packer-plugin-sdk/template/config"
 	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
 	"github.com/rs/xid"
 	"github.com/thomasklein94/packer-plugin-libvirt/builder/libvirt/network"
 	"github.com/thomasklein94/packer-plugin-libvirt/builder/libvirt/volume"
+	libvirtutils "github.com/thomasklein94/packer-plugin-libvirt/libvirt-utils"
 )
 
 type Config struct {
@@ -25,9 +27,19 @@ type Config struct {
 	Communicator communicator.Config `mapstructure:"communicator"`
 	//
 	BootConfig BootConfig `mapstructure:",squash"`
+	// See [Direct kernel boot](#direct-kernel-boot).
+	DirectKernelBoot DirectKernelBoot `mapstructure:",squash"`
+	// Packer's HTTP server, serving `http_directory` or `http_content` to the domain.
+	// See [Network boot](#network-boot).
+	HTTPConfig commonsteps.HTTPConfig `mapstructure:",squash"`
 	// The libvirt name of the domain (virtual machine) running your build
 	// If not specified, a random name with the prefix `packer-` will be used
 	DomainName string `mapstructure:"domain_name" required:"false"`
+	// What to do when a domain named `domain_name` is already defined in libvirt.
+	// `fail` (the default) stops the build, `replace` undefines the existing domain if it's not running
+	// and `rename` appends a numeric suffix to the name of the build's domain. Volume names generated from the
+	// domain name follow the renamed domain.
+	DomainOnConflict string `mapstructure:"domain_on_conflict" required:"false"`
 	// The amount of memory to use when building the VM
 	// in megabytes. This defaults to 512 megabytes.
 	MemorySize int `mapstructure:"memory" required:"false"`
@@ -42,20 +54,47 @@ type Config struct {
 
 	// Network interface attachments. See [Network](#network) for more.
 	NetworkInterfaces []network.NetworkInterface `mapstructure:"network_interface" required:"false"`
+	// A transient network to boot the domain from over PXE or HTTP. See [Network boot](#network-boot).
+	PxeNetwork *PxeNetwork `mapstructure:"pxe_network" required:"false"`
 	// The alias of the network interface used for the SSH/WinRM connections
 	// See [Communicators and network interfaces](#communicators-and-network-interfaces)
 	CommunicatorInterface string `mapstructure:"communicator_interface" required:"false"`
 
 	// See [Volumes](#volumes)
 	Volumes []volume.Volume `mapstructure:"volume" required:"false"`
+	// Disk controllers of the domain. SCSI volumes use virtio-scsi controllers unless declared otherwise.
+	// See [Disk controllers](#disk-controllers).
+	Controllers []DiskController `mapstructure:"controller" required:"false"`
 	// The alias of the drive designated to be the artifact. To learn more,
 	// see [Volumes](#volumes)
 	ArtifactVolumeAlias string `mapstructure:"artifact_volume_alias" required:"false"`
+	// The maximum number of volumes being prepared (downloaded, assembled and uploaded) at the same time.
+	// A volume using another volume of the same build as a backing store or a cloning source
+	// always waits for that volume to be ready. Set it to `1` to prepare volumes one after another.
+	// Defaults to `4`.
+	VolumeParallelism int `mapstructure:"volume_parallelism" required:"false"`
+	// Before creating any volume, Packer sums up the capacity of the volumes per storage pool and
+	// fails early if a pool doesn't have enough free space for them. Set this to `true` to skip the check.
+	SkipPoolCapacityCheck bool `mapstructure:"skip_pool_capacity_check" required:"false"`
+	// Allow thinly provisioned volumes to overcommit their storage pool. If set, only the allocation (`size`)
+	// of the volumes has to fit into the free space of the pool instead of their whole capacity.
+	AllowPoolOvercommit bool `mapstructure:"allow_pool_overcommit" required:"false"`
+	// Storage pools to create if they don't exist yet. See [Creating storage pools](#creating-storage-pools).
+	CreatePools []CreatePool `mapstructure:"create_pool" required:"false"`
+	// Delete older artifacts from the artifact's pool after a successful build.
+	// See [Artifact retention](#artifact-retention).
+	ArtifactRetention ArtifactRetention `mapstructure:"artifact_retention" required:"false"`
 
 	// Device(s) from which to boot, defaults to hard drive (first volume)
-	// Available boot devices are: `hd`, `network`, `cdrom`
+	// Available boot devices are: `hd`, `network`, `cdrom`.
+	// Can't be combined with the `boot_order` of volumes and network interfaces, see [Boot order](#boot-order).
 	BootDevices []string `mapstructure:"boot_devices" required:"false"`
 
+	// Aliases of the install media volumes to take out of the domain once the installer reboots it.
+	// cdrom and floppy drives are emptied, other disks are detached, and the domain boots from its disk.
+	// See [Ejecting install media](#ejecting-install-media).
+	EjectOnReboot []string `mapstructure:"eject_on_reboot" required:"false"`
+
 	// See [Graphics and video, headless domains](#graphics-and-video-headless-domains).
 	DomainGraphics []DomainGraphic `mapstructure:"graphics" required:"false"`
 
@@ -84,14 +123,21 @@ type Config struct {
 	// Libvirt Machine Type
 	// Value for domain XML's machine type. If unsure, leave it empty
 	Chipset string `mapstructure:"chipset" required:"false"`
+	// The firmware of the domain, `bios` or `efi`. libvirt picks the firmware images and the NVRAM template
+	// of the host matching it and `secure_boot` and `enrolled_keys`, so their paths don't have to be known.
+	// Can't be combined with `loader_path` and `nvram_template`. See [Firmware](#firmware).
+	Firmware string `mapstructure:"firmware" required:"false"`
+	// With `firmware = "efi"`, pick a firmware with Secure Boot enrolled keys, so Secure Boot is enabled
+	// from the first boot. Requires `secure_boot`.
+	EnrolledKeys bool `mapstructure:"enrolled_keys" required:"false"`
 	// [Expert] Refers to a firmware blob, which is specified by absolute path, used to assist the domain creation process.
 	// If unsure, leave it empty.
 	LoaderPath string `mapstructure:"loader_path" required:"false"`
 	// [Expert] Accepts values rom and pflash. It tells the hypervisor where in the guest memory the loader(rom) should be mapped.
 	// If unsure, leave it empty.
 	LoaderType string `mapstructure:"loader_type" required:"false"`
-	// [Expert] Some firmwares may implement the Secure boot feature.
-	// This attribute can be used to tell the hypervisor that the firmware is capable of Secure Boot feature.
+	// With `firmware = "efi"`, pick a firmware supporting Secure Boot. Otherwise a firmware without it is picked.
+	// [Expert] With `loader_path`, it tells the hypervisor that the firmware is capable of Secure Boot feature.
 	// It cannot be used to enable or disable the feature itself in the firmware.
 	// If unsure, leave it empty.
 	SecureBoot bool `mapstructure:"secure_boot" required:"false"`
@@ -103,6 +149,10 @@ type Config struct {
 	// If needed, the template attribute can be used to per domain override map of master NVRAM stores from the config file.
 	// If unsure, leave it empty.
 	NvramTemplate string `mapstructure:"nvram_template" required:"false"`
+	// Enroll your own Secure Boot certificates into the NVRAM of the domain.
+	// Requires `loader_path` and `secure_boot`, and can't be combined with `firmware`.
+	// See [Secure Boot keys](#secure-boot-keys).
+	SecureBootKeys *SecureBootKeys `mapstructure:"secure_boot_keys" required:"false"`
 
 	ctx interpolate.Context
 }
@@ -141,7 +191,10 @@ func (c *Config) Prepare(raws ...interface{}) ([]string, error) {
 		PluginType:         "libvirt",
 		Interpolate:        true,
 		InterpolateContext: &c.ctx,
-		InterpolateFilter:  &interpolate.RenderFilter{},
+		InterpolateFilter: &interpolate.RenderFilter{
+			// Rendered once the address and the port of the HTTP server are known
+			Exclude: []string{"boot_command", "cmdline"},
+		},
 	}, raws...)
 
 	if err != nil {
@@ -157,6 +210,16 @@ func (c *Config) Prepare(raws ...interface{}) ([]string, error) {
 		c.DomainName = fmt.Sprintf("packer-%s", xid.New())
 	}
 
+	switch c.DomainOnConflict {
+	case "":
+		c.DomainOnConflict = volume.ConflictFail
+	case volume.ConflictFail, volume.ConflictReplace, volume.ConflictRename:
+	case volume.ConflictReuse:
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("domain_on_conflict can't be reuse, the build always defines its own domain"))
+	default:
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("unknown domain_on_conflict: %s", c.DomainOnConflict))
+	}
+
 	if c.CpuCount <= 0 {
 		c.CpuCount = 1
 	}
@@ -165,7 +228,27 @@ func (c *Config) Prepare(raws ...interface{}) ([]string, error) {
 		c.MemorySize = 512
 	}
 
-	if len(c.BootDevices) == 0 {
+	errs = packersdk.MultiErrorAppend(errs, c.prepareFirmware()...)
+	errs = packersdk.MultiErrorAppend(errs, c.prepareSecureBootKeys()...)
+
+	errs = packersdk.MultiErrorAppend(errs, c.HTTPConfig.Prepare(&c.ctx)...)
+
+	if c.PxeNetwork != nil {
+		errs = packersdk.MultiErrorAppend(errs, c.PxeNetwork.Prepare(c.DomainName)...)
+		if c.PxeNetwork.HttpBootFile != "" && c.HTTPConfig.HTTPDir == "" && len(c.HTTPConfig.HTTPContent) == 0 {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("the http_boot_file of pxe_network needs http_directory or http_content to be served from"))
+		}
+		c.NetworkInterfaces = append(c.NetworkInterfaces, c.PxeNetwork.NetworkInterface())
+	}
+
+	bootOrderErrs, perDeviceBootOrder := c.prepareBootOrder()
+	errs = packersdk.MultiErrorAppend(errs, bootOrderErrs...)
+
+	if perDeviceBootOrder {
+		if len(c.BootDevices) > 0 {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("boot_devices can't be combined with the boot_order of volumes and network interfaces"))
+		}
+	} else if len(c.BootDevices) == 0 {
 		c.BootDevices = []string{"hd"}
 	} else {
 		for _, bd := range c.BootDevices {
@@ -182,7 +265,18 @@ func (c *Config) Prepare(raws ...interface{}) ([]string, error) {
 		}
 	}
 
-	volume.ResetDeviceLetters()
+	if c.VolumeParallelism <= 0 {
+		c.VolumeParallelism = 4
+	}
+
+	poolNames := map[string]bool{}
+	for i := range c.CreatePools {
+		errs = packersdk.MultiErrorAppend(errs, c.CreatePools[i].Prepare()...)
+		if poolNames[c.CreatePools[i].Name] {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("create_pool %s is specified more than once", c.CreatePools[i].Name))
+		}
+		poolNames[c.CreatePools[i].Name] = true
+	}
 
 	for i, volumeDef := range c.Volumes {
 		w, e := volumeDef.PrepareConfig(&c.ctx, c.DomainName)
@@ -191,6 +285,45 @@ func (c *Config) Prepare(raws ...interface{}) ([]string, error) {
 		c.Volumes[i] = volumeDef
 	}
 
+	// A libvirt host local to the runner gains nothing from fetching on its own
+	uri := libvirtutils.LibvirtUri{}
+	if uri.Unmarshal(c.LibvirtURI) == nil && uri.IsLocal() {
+		for _, vol := range c.Volumes {
+			if vol.Source != nil && vol.Source.Type == "external" && vol.Source.External.FetchOn == "host" {
+				warnings = append(warnings, fmt.Sprintf("libvirt runs on this machine, volume %s/%s is downloaded by Packer despite fetch_on = \"host\"", vol.Pool, vol.Name))
+			}
+		}
+	}
+
+	// A renamed volume no longer matches the references of the volumes derived from it
+	for i := range c.Volumes {
+		for j := range c.Volumes {
+			if i != j && c.Volumes[i].DependsOn(&c.Volumes[j]) && c.Volumes[j].OnConflict == volume.ConflictRename {
+				errs = packersdk.MultiErrorAppend(errs, fmt.Errorf(
+					"volume %s/%s can't have on_conflict = rename, volume %s/%s is derived from it",
+					c.Volumes[j].Pool, c.Volumes[j].Name, c.Volumes[i].Pool, c.Volumes[i].Name,
+				))
+			}
+			// With domain_on_conflict = rename, the generated name changes with the domain name at build time
+			if i != j && c.Volumes[i].DependsOn(&c.Volumes[j]) && c.Volumes[j].NameFromDomain() && c.DomainOnConflict == volume.ConflictRename {
+				errs = packersdk.MultiErrorAppend(errs, fmt.Errorf(
+					"volume %s/%s is derived from volume %s/%s, which needs an explicit name when domain_on_conflict is rename",
+					c.Volumes[i].Pool, c.Volumes[i].Name, c.Volumes[j].Pool, c.Volumes[j].Name,
+				))
+			}
+		}
+	}
+
+	controllerCounts := map[string]int{}
+	for i := range c.Controllers {
+		errs = packersdk.MultiErrorAppend(errs, c.Controllers[i].Prepare()...)
+		c.Controllers[i].index = controllerCounts[c.Controllers[i].Type]
+		controllerCounts[c.Controllers[i].Type]++
+	}
+
+	errs = packersdk.MultiErrorAppend(errs, c.prepareDevices()...)
+	errs = packersdk.MultiErrorAppend(errs, c.prepareBusSupport()...)
+
 	for i, ni := range c.NetworkInterfaces {
 		w, e := ni.PrepareConfig(&c.ctx)
 		warnings = append(warnings, w...)
@@ -200,12 +333,27 @@ func (c *Config) Prepare(raws ...interface{}) ([]string, error) {
 
 	warnings, errs = c.prepareCommunicator(warnings, errs)
 
+	errs = packersdk.MultiErrorAppend(errs, c.ArtifactRetention.Prepare()...)
+
 	if len(c.Volumes) == 0 {
 		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("no volume has been specified"))
 	} else {
 		errs, warnings = c.prepareArtifactVolume(errs, warnings)
 	}
 
+	errs = packersdk.MultiErrorAppend(errs, c.prepareEjectOnReboot()...)
+
+	errs = packersdk.MultiErrorAppend(errs, c.DirectKernelBoot.Prepare()...)
+	if c.DirectKernelBoot.Enabled() {
+		// Boot files are added after the artifact was chosen, they're never attached as disks
+		for _, bootVolume := range c.DirectKernelBoot.BootFileVolumes(c.DomainName) {
+			w, e := bootVolume.PrepareConfig(&c.ctx, c.DomainName)
+			warnings = append(warnings, w...)
+			errs = packersdk.MultiErrorAppend(errs, e...)
+			c.Volumes = append(c.Volumes, bootVolume)
+		}
+	}
+
 	if c.NetworkAddressSource == "" {
 		c.NetworkAddressSource = "agent"
 		warnings = append(warnings, "No network_address_source was specified, defaulting to agent. This might hang your build when there are no qemu agent running on the builder machine")
@@ -243,6 +391,79 @@ func (c *Config) Prepare(raws ...interface{}) ([]string, error) {
 	return warnings, nil
 }
 
+// prepareEjectOnReboot resolves the aliases of the install media to eject to the aliases of their volumes
+func (c *Config) prepareEjectOnReboot() (errs []error) {
+	for i, alias := range c.EjectOnReboot {
+		prefixed := fmt.Sprintf("ua-%s", alias)
+		found := false
+		for _, vol := range c.Volumes {
+			if vol.Alias == prefixed {
+				found = true
+				if prefixed == c.ArtifactVolumeAlias {
+					errs = append(errs, fmt.Errorf("the artifact volume '%s' can't be ejected on reboot", alias))
+				}
+				break
+			}
+		}
+		if !found {
+			errs = append(errs, fmt.Errorf("no volume found with alias '%s' to eject on reboot", alias))
+		}
+		c.EjectOnReboot[i] = prefixed
+	}
+	return
+}
+
+// prepareBootOrder checks the per-device boot orders and reports whether any device has one
+func (c *Config) prepareBootOrder() (errs []error, used bool) {
+	devices := map[uint]string{}
+
+	add := func(order uint, device string) {
+		if order == 0 {
+			return
+		}
+		if other, ok := devices[order]; ok {
+			errs = append(errs, fmt.Errorf("boot_order %d is used by both %s and %s", order, other, device))
+			return
+		}
+		devices[order] = device
+	}
+
+	for i, vol := range c.Volumes {
+		add(vol.BootOrder, fmt.Sprintf("volume #%d", i+1))
+	}
+	for i, ni := range c.NetworkInterfaces {
+		add(ni.BootOrder, fmt.Sprintf("network interface #%d", i+1))
+	}
+
+	return errs, len(devices) > 0
+}
+
+// prepareDevices gives every volume a target device and drive address. Every build has its own allocator,
+// and explicit targets are reserved first, so they can be set on any volume regardless of the order.
+func (c *Config) prepareDevices() (errs []error) {
+	allocator := volume.NewDeviceAllocator()
+
+	for _, controller := range c.Controllers {
+		if units, ok := controller.units(); ok {
+			allocator.SetControllerUnits(controller.Type, controller.index, units)
+		}
+	}
+
+	for i := range c.Volumes {
+		if err := c.Volumes[i].ReserveTargetDev(allocator); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for i := range c.Volumes {
+		if err := c.Volumes[i].AssignDevice(allocator); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return
+}
+
 func (c *Config) prepareArtifactVolume(errs *packersdk.MultiError, warnings []string) (*packersdk.MultiError, []string) {
 	original := c.ArtifactVolumeAlias
 	if original == "" {
@@ -256,13 +477,17 @@ func (c *Config) prepareArtifactVolume(errs *packersdk.MultiError, warnings []st
 
 		if vol.Alias == c.ArtifactVolumeAlias {
 			found = true
+			// Files and block devices of the host are never owned by the build
+			if !vol.IsPoolVolume() {
+				errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("the artifact volume must be a pool volume, %s is a host %s", vol.Path, vol.Type))
+			}
 			break
 		}
 	}
 	if !found {
 		if original != "" {
 			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("no volume found with alias '%s'", original))
-		} else if len(c.Volumes) == 1 {
+		} else if len(c.Volumes) == 1 && c.Volumes[0].IsPoolVolume() {
 			warnings = append(warnings, "Using the only defined volume as an artifact")
 			vol0 := c.Volumes[0]
 			vol0.Alias = c.ArtifactVolumeAlias
@@ -0,0 +1,140 @@
+//go:generate go run github.com/hashicorp/packer-plugin-sdk/cmd/packer-sdc struct-markdown
+
+package libvirt
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/thomasklein94/packer-plugin-libvirt/builder/libvirt/volume"
+	libvirtutils "github.com/thomasklein94/packer-plugin-libvirt/libvirt-utils"
+	"libvirt.org/go/libvirtxml"
+)
+
+type DiskController struct {
+	// The type of the controller: `scsi`, `sata` (AHCI), `ide`, `nvme` or `usb`.
+	// Controllers of the same type are numbered in the order of declaration, starting from 0.
+	Type string `mapstructure:"type" required:"true"`
+	// The model of the controller. SCSI controllers default to `virtio-scsi`, other models like `lsilogic`
+	// are emulated and slow, and only take 7 disks each. USB controllers default to `qemu-xhci`.
+	// Leave it empty for any other type.
+	Model string `mapstructure:"model" required:"false"`
+	// The number of request queues of a `virtio-scsi` controller, usually the number of vCPUs.
+	Queues uint `mapstructure:"queues" required:"false"`
+	// Run the controller in the given I/O thread of the domain, numbered from 1. Only for `virtio-scsi` controllers.
+	IOThread uint `mapstructure:"iothread" required:"false"`
+
+	index int
+}
+
+var scsiControllerModels = []string{
+	"auto", "buslogic", "ibmvscsi", "lsilogic", "lsisas1068", "lsisas1078", "vmpvscsi",
+	"virtio-scsi", "virtio-transitional", "virtio-non-transitional", "ncr53c90", "am53c974", "dc390",
+}
+
+var usbControllerModels = []string{
+	"piix3-uhci", "piix4-uhci", "ehci", "ich9-ehci1", "ich9-uhci1", "ich9-uhci2", "ich9-uhci3",
+	"vt82c686b-uhci", "pci-ohci", "nec-xhci", "qusb1", "qusb2", "qemu-xhci",
+}
+
+// Machine types without PCI, which can't take the controllers of NVMe and USB disks
+var machinesWithoutPci = []string{"microvm", "isapc"}
+
+func (dc *DiskController) Prepare() (errs []error) {
+	switch dc.Type {
+	case "scsi":
+		if dc.Model == "" {
+			dc.Model = "virtio-scsi"
+		}
+		if !libvirtutils.ContainsString(scsiControllerModels, dc.Model) {
+			errs = append(errs, fmt.Errorf("unknown scsi controller model '%s', must be one of %s", dc.Model, strings.Join(scsiControllerModels, ", ")))
+		}
+	case "usb":
+		if dc.Model == "" {
+			dc.Model = "qemu-xhci"
+		}
+		if !libvirtutils.ContainsString(usbControllerModels, dc.Model) {
+			errs = append(errs, fmt.Errorf("unknown usb controller model '%s', must be one of %s", dc.Model, strings.Join(usbControllerModels, ", ")))
+		}
+	case "sata", "nvme":
+		if dc.Model != "" {
+			errs = append(errs, fmt.Errorf("%s controllers don't have models", dc.Type))
+		}
+	case "ide":
+	default:
+		errs = append(errs, fmt.Errorf("unsupported controller type '%s', must be one of scsi, sata, ide, nvme or usb", dc.Type))
+	}
+
+	if (dc.Queues != 0 || dc.IOThread != 0) && !dc.isVirtio() {
+		errs = append(errs, fmt.Errorf("queues and iothread are only supported on virtio-scsi controllers"))
+	}
+
+	return
+}
+
+func (dc *DiskController) isVirtio() bool {
+	return dc.Type == "scsi" && strings.HasPrefix(dc.Model, "virtio")
+}
+
+// units returns the number of disks the controller takes, if it differs from the default of its bus
+func (dc *DiskController) units() (int, bool) {
+	if dc.Type == "scsi" && !dc.isVirtio() {
+		return volume.NarrowScsiUnits, true
+	}
+	return 0, false
+}
+
+func (dc *DiskController) DomainController() libvirtxml.DomainController {
+	index := uint(dc.index)
+	controller := libvirtxml.DomainController{
+		Type:  dc.Type,
+		Index: &index,
+		Model: dc.Model,
+	}
+
+	if dc.Queues != 0 || dc.IOThread != 0 {
+		controller.Driver = &libvirtxml.DomainControllerDriver{
+			IOThread: dc.IOThread,
+		}
+		if dc.Queues != 0 {
+			queues := dc.Queues
+			controller.Driver.Queues = &queues
+		}
+	}
+
+	return controller
+}
+
+// prepareBusSupport checks whether the domain can have the NVMe and USB controllers its disks need
+func (c *Config) prepareBusSupport() (errs []error) {
+	buses := []string{}
+	for _, vol := range c.Volumes {
+		if vol.RequiresPciController() && !libvirtutils.ContainsString(buses, vol.Bus) {
+			buses = append(buses, vol.Bus)
+		}
+	}
+	for _, controller := range c.Controllers {
+		if (controller.Type == "nvme" || controller.Type == "usb") && !libvirtutils.ContainsString(buses, controller.Type) {
+			buses = append(buses, controller.Type)
+		}
+	}
+
+	// The domain type defaults to kvm later on
+	domainType := c.DomainType
+	if domainType == "" {
+		domainType = "kvm"
+	}
+
+	for _, bus := range buses {
+		if domainType != "kvm" && domainType != "qemu" {
+			errs = append(errs, fmt.Errorf("%s disks are only supported by kvm and qemu domains, domain_type is %s", bus, domainType))
+		}
+		for _, machine := range machinesWithoutPci {
+			if strings.HasPrefix(c.Chipset, machine) {
+				errs = append(errs, fmt.Errorf("%s disks need a machine type with PCI, %s has none", bus, c.Chipset))
+			}
+		}
+	}
+
+	return
+}
@@ -0,0 +1,66 @@
+//go:generate go run github.com/hashicorp/packer-plugin-sdk/cmd/packer-sdc struct-markdown
+
+package libvirt
+
+import (
+	"fmt"
+
+	"github.com/thomasklein94/packer-plugin-libvirt/builder/libvirt/volume"
+)
+
+type DirectKernelBoot struct {
+	// The kernel to boot the domain with instead of its firmware booting a disk. A local file or a URL,
+	// which is uploaded into `boot_files_pool` for the duration of the build.
+	Kernel string `mapstructure:"kernel" required:"false"`
+	// The initial ramdisk of the kernel, a local file or a URL. Requires `kernel`.
+	Initrd string `mapstructure:"initrd" required:"false"`
+	// The command line of the kernel, like `inst.ks=http://example.com/ks.cfg console=ttyS0`. Requires `kernel`.
+	// It's rendered like the boot command once the HTTP server runs, so `{{ .HTTPIP }}` and `{{ .HTTPPort }}` can be used.
+	Cmdline string `mapstructure:"cmdline" required:"false"`
+	// The device tree blob of the kernel, a local file or a URL. Requires `kernel`.
+	Dtb string `mapstructure:"dtb" required:"false"`
+	// The storage pool the kernel, the initrd and the device tree are uploaded to. It has to be a file based pool,
+	// like a `dir` pool, so the hypervisor can read them from their path. Defaults to `default`.
+	BootFilesPool string `mapstructure:"boot_files_pool" required:"false"`
+}
+
+func (k *DirectKernelBoot) Enabled() bool {
+	return k.Kernel != ""
+}
+
+func (k *DirectKernelBoot) Prepare() (errs []error) {
+	if !k.Enabled() {
+		if k.Initrd != "" || k.Cmdline != "" || k.Dtb != "" {
+			errs = append(errs, fmt.Errorf("initrd, cmdline and dtb require a kernel"))
+		}
+		return
+	}
+
+	if k.BootFilesPool == "" {
+		k.BootFilesPool = "default"
+	}
+
+	return
+}
+
+// BootFileVolumes returns the volumes the kernel, the initrd and the device tree are uploaded to
+func (k *DirectKernelBoot) BootFileVolumes(domainName string) []volume.Volume {
+	volumes := []volume.Volume{}
+
+	files := []struct {
+		bootFile string
+		url      string
+	}{
+		{volume.BootFileKernel, k.Kernel},
+		{volume.BootFileInitrd, k.Initrd},
+		{volume.BootFileDtb, k.Dtb},
+	}
+
+	for _, file := range files {
+		if file.url != "" {
+			volumes = append(volumes, volume.NewBootFileVolume(k.BootFilesPool, domainName, file.bootFile, file.url))
+		}
+	}
+
+	return volumes
+}
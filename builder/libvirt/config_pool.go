@@ -0,0 +1,48 @@
+//go:generate go run github.com/hashicorp/packer-plugin-sdk/cmd/packer-sdc struct-markdown
+
+package libvirt
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+type CreatePool struct {
+	// The name of the storage pool. Defaults to `default`, the pool volumes are created in
+	// when they don't specify one.
+	Name string `mapstructure:"name" required:"false"`
+	// The type of the storage pool. Only `dir` pools can be created this way, every other pool type
+	// needs a source device or host. Defaults to `dir`.
+	Type string `mapstructure:"type" required:"false"`
+	// The absolute path of the pool's target on the libvirt host. For `dir` pools, this is the
+	// directory holding the volumes, which is created if it doesn't exist yet.
+	Path string `mapstructure:"path" required:"true"`
+	// If set, the pool is defined persistently, so it survives restarts of the libvirt daemon.
+	// By default, the pool is transient and is gone once it's stopped.
+	Persistent bool `mapstructure:"persistent" required:"false"`
+	// Stop (and undefine, if it's persistent) the pool at the end of the build if the build created it.
+	// A pool holding the artifact of a successful build is never destroyed.
+	DestroyOnCleanup bool `mapstructure:"destroy_on_cleanup" required:"false"`
+}
+
+func (p *CreatePool) Prepare() (errs []error) {
+	if p.Name == "" {
+		p.Name = "default"
+	}
+
+	switch p.Type {
+	case "":
+		p.Type = "dir"
+	case "dir":
+	default:
+		errs = append(errs, fmt.Errorf("create_pool %s can't be of type %s, only dir pools can be created without a source device or host", p.Name, p.Type))
+	}
+
+	if p.Path == "" {
+		errs = append(errs, fmt.Errorf("create_pool %s needs a path", p.Name))
+	} else if !filepath.IsAbs(p.Path) {
+		errs = append(errs, fmt.Errorf("the path of create_pool %s must be absolute, got %s", p.Name, p.Path))
+	}
+
+	return
+}
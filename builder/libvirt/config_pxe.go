@@ -0,0 +1,173 @@
+//go:generate go run github.com/hashicorp/packer-plugin-sdk/cmd/packer-sdc struct-markdown
+
+package libvirt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"path/filepath"
+
+	"github.com/thomasklein94/packer-plugin-libvirt/builder/libvirt/network"
+	"libvirt.org/go/libvirtxml"
+)
+
+type PxeNetwork struct {
+	// The name of the transient libvirt network. Defaults to `<domain_name>-pxe`.
+	Name string `mapstructure:"name" required:"false"`
+	// The address of the host on the network, with the prefix length of the network.
+	// The rest of the network is handed out by DHCP. Defaults to `192.168.251.1/24`.
+	Address string `mapstructure:"address" required:"false"`
+	// A directory on the libvirt host served over TFTP, holding the boot loader and the files it loads.
+	TftpRoot string `mapstructure:"tftp_root" required:"false"`
+	// The file the firmware boots over TFTP, relative to `tftp_root`, like `pxelinux.0` or `grubx64.efi`.
+	BootFile string `mapstructure:"boot_file" required:"false"`
+	// The path of the file the firmware boots over HTTP, served by Packer from `http_directory` or `http_content`,
+	// like `/EFI/BOOT/BOOTX64.EFI`. UEFI HTTP boot only. Can't be combined with `boot_file`.
+	HttpBootFile string `mapstructure:"http_boot_file" required:"false"`
+	// The address the domain reaches Packer's HTTP server on. Defaults to the host's `address` on the network,
+	// which only works if Packer runs on the libvirt host.
+	HttpHost string `mapstructure:"http_host" required:"false"`
+	// Isolate the network instead of forwarding its traffic to the outside world with NAT.
+	Isolated bool `mapstructure:"isolated" required:"false"`
+	// The position of the network's interface in the boot order of the domain.
+	// Can't be combined with `boot_devices`, see [Boot order](#boot-order).
+	BootOrder uint `mapstructure:"boot_order" required:"false"`
+
+	hostIP  net.IP
+	network *net.IPNet
+}
+
+func (p *PxeNetwork) Prepare(domainName string) (errs []error) {
+	if p.Name == "" {
+		p.Name = fmt.Sprintf("%s-pxe", domainName)
+	}
+
+	if p.Address == "" {
+		p.Address = "192.168.251.1/24"
+	}
+
+	hostIP, ipNet, err := net.ParseCIDR(p.Address)
+	if err != nil || hostIP.To4() == nil {
+		errs = append(errs, fmt.Errorf("pxe_network address must be an IPv4 address with a prefix length, like 192.168.251.1/24, got '%s'", p.Address))
+	} else if ones, _ := ipNet.Mask.Size(); ones > 29 {
+		errs = append(errs, fmt.Errorf("pxe_network address %s leaves no room for DHCP, use a prefix length of 29 or less", p.Address))
+	} else if hostIP.Equal(ipNet.IP) || hostIP.Equal(broadcastAddress(ipNet)) {
+		errs = append(errs, fmt.Errorf("pxe_network address %s is not a host address of its network", p.Address))
+	} else {
+		p.hostIP = hostIP.To4()
+		p.network = ipNet
+	}
+
+	if p.BootFile == "" && p.HttpBootFile == "" {
+		errs = append(errs, fmt.Errorf("pxe_network needs a boot_file served over TFTP or an http_boot_file served over HTTP"))
+	}
+	if p.BootFile != "" && p.HttpBootFile != "" {
+		errs = append(errs, fmt.Errorf("pxe_network can't have both a boot_file and an http_boot_file"))
+	}
+	if p.BootFile != "" && p.TftpRoot == "" {
+		errs = append(errs, fmt.Errorf("the boot_file of pxe_network needs a tftp_root"))
+	}
+	if p.TftpRoot != "" && !filepath.IsAbs(p.TftpRoot) {
+		errs = append(errs, fmt.Errorf("the tftp_root of pxe_network must be an absolute path, got '%s'", p.TftpRoot))
+	}
+
+	return
+}
+
+// NetworkInterface is the interface attaching the domain to the network
+func (p *PxeNetwork) NetworkInterface() network.NetworkInterface {
+	return network.NetworkInterface{
+		Type:      "managed",
+		Alias:     "pxe",
+		BootOrder: p.BootOrder,
+		Managed: network.ManagedNetworkInterface{
+			Network: p.Name,
+		},
+	}
+}
+
+// NetworkDefinition creates the definition of the network. The URL of an HTTP boot file needs the port of Packer's HTTP server.
+func (p *PxeNetwork) NetworkDefinition(httpPort int) libvirtxml.Network {
+	ones, _ := p.network.Mask.Size()
+
+	ip := libvirtxml.NetworkIP{
+		Address: p.hostIP.String(),
+		Prefix:  uint(ones),
+		DHCP: &libvirtxml.NetworkDHCP{
+			Ranges: []libvirtxml.NetworkDHCPRange{p.dhcpRange()},
+		},
+	}
+
+	if p.BootFile != "" {
+		ip.DHCP.Bootp = []libvirtxml.NetworkBootp{{File: p.BootFile}}
+	}
+
+	if p.TftpRoot != "" {
+		ip.TFTP = &libvirtxml.NetworkTFTP{Root: p.TftpRoot}
+	}
+
+	networkDef := libvirtxml.Network{
+		Name: p.Name,
+		IPs:  []libvirtxml.NetworkIP{ip},
+	}
+
+	if !p.Isolated {
+		networkDef.Forward = &libvirtxml.NetworkForward{Mode: "nat"}
+	}
+
+	if p.HttpBootFile != "" {
+		networkDef.DnsmasqOptions = &libvirtxml.NetworkDnsmasqOptions{
+			Option: httpBootDnsmasqOptions(p.httpBootUrl(httpPort)),
+		}
+	}
+
+	return networkDef
+}
+
+func (p *PxeNetwork) httpBootUrl(httpPort int) string {
+	host := p.HttpHost
+	if host == "" {
+		host = p.hostIP.String()
+	}
+	return fmt.Sprintf("http://%s%s", net.JoinHostPort(host, fmt.Sprint(httpPort)), p.HttpBootFile)
+}
+
+// httpBootDnsmasqOptions answers UEFI HTTP boot clients. The firmware ignores every offer
+// without the vendor class HTTPClient, which libvirt's own bootp settings can't send.
+func httpBootDnsmasqOptions(url string) []libvirtxml.NetworkDnsmasqOption {
+	return []libvirtxml.NetworkDnsmasqOption{
+		{Value: "dhcp-vendorclass=set:efi-http,HTTPClient"},
+		{Value: "dhcp-option-force=tag:efi-http,60,HTTPClient"},
+		{Value: fmt.Sprintf("dhcp-boot=tag:efi-http,%s", url)},
+	}
+}
+
+// dhcpRange hands out the addresses of the network after the host's address, or before it if it's at the end
+func (p *PxeNetwork) dhcpRange() libvirtxml.NetworkDHCPRange {
+	first := binary.BigEndian.Uint32(p.network.IP.To4()) + 1
+	last := binary.BigEndian.Uint32(broadcastAddress(p.network)) - 1
+	host := binary.BigEndian.Uint32(p.hostIP)
+
+	start, end := host+1, last
+	if host+1 > last-1 {
+		start, end = first, host-1
+	}
+
+	return libvirtxml.NetworkDHCPRange{
+		Start: uint32ToIP(start).String(),
+		End:   uint32ToIP(end).String(),
+	}
+}
+
+func broadcastAddress(ipNet *net.IPNet) net.IP {
+	network := binary.BigEndian.Uint32(ipNet.IP.To4())
+	mask := binary.BigEndian.Uint32(net.IP(ipNet.Mask).To4())
+	return uint32ToIP(network | ^mask)
+}
+
+func uint32ToIP(value uint32) net.IP {
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, value)
+	return ip
+}
@@ -0,0 +1,81 @@
+package libvirt
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestBroadcastAddress(t *testing.T) {
+	tests := map[string]string{
+		"192.168.251.0/24": "192.168.251.255",
+		"10.0.0.0/8":       "10.255.255.255",
+		"172.16.4.0/22":    "172.16.7.255",
+		"192.168.1.8/29":   "192.168.1.15",
+	}
+
+	for cidr, expected := range tests {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatalf("%s: %s", cidr, err)
+		}
+		if broadcast := broadcastAddress(ipNet).String(); broadcast != expected {
+			t.Errorf("%s: expected %s, got %s", cidr, expected, broadcast)
+		}
+	}
+}
+
+func TestDhcpRange(t *testing.T) {
+	tests := []struct {
+		address string
+		start   string
+		end     string
+	}{
+		{"192.168.251.1/24", "192.168.251.2", "192.168.251.254"},
+		{"192.168.251.100/24", "192.168.251.101", "192.168.251.254"},
+		// The host at the end of the network gets the range before it
+		{"192.168.251.254/24", "192.168.251.1", "192.168.251.253"},
+		{"192.168.251.253/24", "192.168.251.1", "192.168.251.252"},
+		{"192.168.1.9/29", "192.168.1.10", "192.168.1.14"},
+		{"192.168.1.14/29", "192.168.1.9", "192.168.1.13"},
+	}
+
+	for _, tt := range tests {
+		p := &PxeNetwork{Address: tt.address, BootFile: "pxelinux.0", TftpRoot: "/srv/tftp"}
+		if errs := p.Prepare("domain"); len(errs) > 0 {
+			t.Fatalf("%s: unexpected errors: %v", tt.address, errs)
+		}
+
+		dhcpRange := p.dhcpRange()
+		if dhcpRange.Start != tt.start || dhcpRange.End != tt.end {
+			t.Errorf("%s: expected %s-%s, got %s-%s", tt.address, tt.start, tt.end, dhcpRange.Start, dhcpRange.End)
+		}
+	}
+}
+
+func TestHttpBootNetworkDefinition(t *testing.T) {
+	p := &PxeNetwork{HttpBootFile: "/EFI/BOOT/BOOTX64.EFI"}
+	if errs := p.Prepare("domain"); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	networkDef := p.NetworkDefinition(8080)
+	networkXml, err := networkDef.Marshal()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, expected := range []string{
+		"dhcp-vendorclass=set:efi-http,HTTPClient",
+		"dhcp-option-force=tag:efi-http,60,HTTPClient",
+		"dhcp-boot=tag:efi-http,http://192.168.251.1:8080/EFI/BOOT/BOOTX64.EFI",
+	} {
+		if !strings.Contains(networkXml, expected) {
+			t.Errorf("expected %s in the network definition:\n%s", expected, networkXml)
+		}
+	}
+
+	if strings.Contains(networkXml, "<bootp") {
+		t.Errorf("expected no bootp element for HTTP boot:\n%s", networkXml)
+	}
+}
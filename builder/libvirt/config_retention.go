@@ -0,0 +1,65 @@
+//go:generate go run github.com/hashicorp/packer-plugin-sdk/cmd/packer-sdc struct-markdown
+
+package libvirt
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type ArtifactRetention struct {
+	// Older artifacts are the volumes in the artifact's pool whose name starts with this prefix.
+	NamePrefix string `mapstructure:"name_prefix" required:"false"`
+	// Older artifacts are the volumes in the artifact's pool whose name matches this regular expression.
+	// If both `name_prefix` and `name_regex` are set, a volume has to match both.
+	NameRegex string `mapstructure:"name_regex" required:"false"`
+	// Keep the given number of the most recently modified matching volumes, including the new artifact if its name matches.
+	KeepLast int `mapstructure:"keep_last" required:"false"`
+	// Keep every matching volume modified within this duration, for example `168h` for a week.
+	KeepYoungerThan time.Duration `mapstructure:"keep_younger_than" required:"false"`
+}
+
+// Enabled reports whether any older artifact should be looked for at all
+func (r *ArtifactRetention) Enabled() bool {
+	return r.NamePrefix != "" || r.NameRegex != ""
+}
+
+func (r *ArtifactRetention) Prepare() (errs []error) {
+	if !r.Enabled() {
+		if r.KeepLast != 0 || r.KeepYoungerThan != 0 {
+			errs = append(errs, fmt.Errorf("artifact_retention needs name_prefix or name_regex to find older artifacts"))
+		}
+		return
+	}
+
+	if r.NameRegex != "" {
+		if _, err := regexp.Compile(r.NameRegex); err != nil {
+			errs = append(errs, fmt.Errorf("invalid artifact_retention name_regex: %s", err))
+		}
+	}
+
+	if r.KeepLast < 0 || r.KeepYoungerThan < 0 {
+		errs = append(errs, fmt.Errorf("artifact_retention keep_last and keep_younger_than can't be negative"))
+	}
+
+	if r.KeepLast == 0 && r.KeepYoungerThan == 0 {
+		errs = append(errs, fmt.Errorf("artifact_retention needs keep_last or keep_younger_than, otherwise every older artifact would be deleted"))
+	}
+
+	return
+}
+
+func (r *ArtifactRetention) matches(name string) bool {
+	if !strings.HasPrefix(name, r.NamePrefix) {
+		return false
+	}
+
+	if r.NameRegex != "" {
+		matched, err := regexp.MatchString(r.NameRegex, name)
+		return err == nil && matched
+	}
+
+	return true
+}
@@ -0,0 +1,122 @@
+//go:generate go run github.com/hashicorp/packer-plugin-sdk/cmd/packer-sdc struct-markdown
+
+package libvirt
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/thomasklein94/packer-plugin-libvirt/builder/libvirt/nvram"
+)
+
+type SecureBootKeys struct {
+	// The certificate of the Platform Key, a PEM or DER encoded X.509 certificate file.
+	PK string `mapstructure:"pk" required:"true"`
+	// Certificates enrolled as Key Exchange Keys, PEM or DER encoded X.509 certificate files.
+	KEK []string `mapstructure:"kek" required:"true"`
+	// Certificates enrolled into the signature database, the images signed by them are allowed to boot.
+	// PEM or DER encoded X.509 certificate files.
+	Db []string `mapstructure:"db" required:"true"`
+	// The GUID recorded as the owner of the enrolled certificates. Defaults to a random GUID.
+	OwnerGuid string `mapstructure:"owner_guid" required:"false"`
+	// The size of the flash of the firmware the variable store is generated for, `4M` or `2M`.
+	// It has to match the firmware in `loader_path`, like `OVMF_CODE_4M.secboot.fd` for `4M`. Defaults to `4M`.
+	FlashSize string `mapstructure:"flash_size" required:"false"`
+	// The storage pool the generated variable store is uploaded to. It has to be a file based pool,
+	// like a `dir` pool, so libvirt can copy it from its path. Defaults to `default`.
+	Pool string `mapstructure:"pool" required:"false"`
+
+	keys   nvram.SecureBootKeys
+	layout nvram.Layout
+}
+
+func (s *SecureBootKeys) Prepare() (errs []error) {
+	if s.PK == "" {
+		errs = append(errs, fmt.Errorf("pk of secure_boot_keys is required"))
+	} else if cert, err := readCertificate(s.PK); err != nil {
+		errs = append(errs, err)
+	} else {
+		s.keys.PK = cert
+	}
+
+	if len(s.KEK) == 0 {
+		errs = append(errs, fmt.Errorf("kek of secure_boot_keys requires at least one certificate"))
+	}
+	if len(s.Db) == 0 {
+		errs = append(errs, fmt.Errorf("db of secure_boot_keys requires at least one certificate"))
+	}
+
+	s.keys.KEK = [][]byte{}
+	for _, path := range s.KEK {
+		if cert, err := readCertificate(path); err != nil {
+			errs = append(errs, err)
+		} else {
+			s.keys.KEK = append(s.keys.KEK, cert)
+		}
+	}
+
+	s.keys.Db = [][]byte{}
+	for _, path := range s.Db {
+		if cert, err := readCertificate(path); err != nil {
+			errs = append(errs, err)
+		} else {
+			s.keys.Db = append(s.keys.Db, cert)
+		}
+	}
+
+	var err error
+	if s.OwnerGuid == "" {
+		s.keys.Owner, err = nvram.NewRandomGuid()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("couldn't generate the owner_guid of secure_boot_keys: %s", err))
+		}
+		s.OwnerGuid = s.keys.Owner.String()
+	} else if s.keys.Owner, err = nvram.ParseGuid(s.OwnerGuid); err != nil {
+		errs = append(errs, fmt.Errorf("owner_guid of secure_boot_keys: %s", err))
+	}
+
+	switch s.FlashSize {
+	case "", "4M":
+		s.FlashSize = "4M"
+		s.layout = nvram.Layout4M
+	case "2M":
+		s.layout = nvram.Layout2M
+	default:
+		errs = append(errs, fmt.Errorf("unknown flash_size '%s' of secure_boot_keys, must be 4M or 2M", s.FlashSize))
+	}
+
+	if s.Pool == "" {
+		s.Pool = "default"
+	}
+
+	return
+}
+
+// VariableStore generates the variable store with the keys enrolled and Secure Boot enabled
+func (s *SecureBootKeys) VariableStore() ([]byte, error) {
+	return nvram.GenerateSecureBootVariableStore(s.layout, s.keys, time.Now())
+}
+
+// readCertificate reads a PEM or DER encoded X.509 certificate and returns it in DER encoding
+func readCertificate(path string) ([]byte, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read certificate %s: %s", path, err)
+	}
+
+	if block, _ := pem.Decode(raw); block != nil {
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("%s holds a %s instead of a certificate", path, block.Type)
+		}
+		raw = block.Bytes
+	}
+
+	if _, err := x509.ParseCertificate(raw); err != nil {
+		return nil, fmt.Errorf("%s is not a valid X.509 certificate: %s", path, err)
+	}
+
+	return raw, nil
+}
@@ -0,0 +1,44 @@
+package libvirt
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFetchOnHostWarnsOnLocalConnection(t *testing.T) {
+	tests := map[string]bool{
+		"qemu:///system":                     true,
+		"qemu+ssh://root@example.com/system": false,
+	}
+
+	for uri, warns := range tests {
+		config := Config{}
+		warnings, err := config.Prepare(map[string]interface{}{
+			"libvirt_uri":  uri,
+			"communicator": map[string]interface{}{"communicator": "none"},
+			"volume": []map[string]interface{}{
+				{
+					"alias": "artifact",
+					"source": map[string]interface{}{
+						"type":     "external",
+						"urls":     []string{"https://example.com/disk.qcow2"},
+						"fetch_on": "host",
+					},
+				},
+			},
+		})
+		if err != nil {
+			t.Fatalf("%s: Prepare: %s", uri, err)
+		}
+
+		found := false
+		for _, w := range warnings {
+			if strings.Contains(w, "fetch_on") {
+				found = true
+			}
+		}
+		if found != warns {
+			t.Errorf("%s: expected a fetch_on warning %t, got %v", uri, warns, warnings)
+		}
+	}
+}
@@ -69,6 +69,57 @@ func newDomainDefinition(config *Config) libvirtxml.Domain {
 		},
 	}
 
+	// Volumes and controllers refer to I/O threads by their number
+	for _, vol := range config.Volumes {
+		if vol.IOThread > domainDef.IOThreads {
+			domainDef.IOThreads = vol.IOThread
+		}
+	}
+	for _, controller := range config.Controllers {
+		if controller.IOThread > domainDef.IOThreads {
+			domainDef.IOThreads = controller.IOThread
+		}
+	}
+
+	declaredControllers := map[string]map[int]bool{}
+	declare := func(controller DiskController) {
+		domainDef.Devices.Controllers = append(domainDef.Devices.Controllers, controller.DomainController())
+		if declaredControllers[controller.Type] == nil {
+			declaredControllers[controller.Type] = map[int]bool{}
+		}
+		declaredControllers[controller.Type][controller.index] = true
+	}
+
+	for _, controller := range config.Controllers {
+		declare(controller)
+	}
+
+	for _, vol := range config.Volumes {
+		bus, index, ok := vol.DriveController()
+		if !ok || declaredControllers[bus][index] {
+			continue
+		}
+		switch bus {
+		case "scsi":
+			// libvirt would add an LSI Logic controller for SCSI disks, which many guests have no driver for
+			declare(DiskController{Type: "scsi", Model: "virtio-scsi", index: index})
+		case "nvme":
+			declare(DiskController{Type: "nvme", index: index})
+		}
+	}
+
+	// The default USB controller of older machine types is USB 1.1, which makes installer media crawl
+	for _, vol := range config.Volumes {
+		if vol.Bus == "usb" && len(declaredControllers["usb"]) == 0 {
+			declare(DiskController{Type: "usb", Model: "qemu-xhci", index: 0})
+		}
+	}
+
+	// The installer's reboot stops the domain, so the install media can be ejected before it starts again
+	if len(config.EjectOnReboot) > 0 {
+		domainDef.OnReboot = "destroy"
+	}
+
 	for _, bd := range config.BootDevices {
 		bootDevice := libvirtxml.DomainBootDevice{Dev: bd}
 		domainDef.OS.BootDevices = append(domainDef.OS.BootDevices, bootDevice)
@@ -106,6 +157,8 @@ func newDomainDefinition(config *Config) libvirtxml.Domain {
 		}
 	}
 
+	config.updateDomainFirmware(&domainDef)
+
 	if config.NvramPath != "" || config.NvramTemplate != "" {
 		domainDef.OS.NVRam = &libvirtxml.DomainNVRam{
 			NVRam:    config.NvramPath,
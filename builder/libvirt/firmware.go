@@ -0,0 +1,134 @@
+package libvirt
+
+import (
+	"fmt"
+
+	libvirtutils "github.com/thomasklein94/packer-plugin-libvirt/libvirt-utils"
+	"libvirt.org/go/libvirtxml"
+)
+
+const (
+	FirmwareBios = "bios"
+	FirmwareEfi  = "efi"
+)
+
+func (c *Config) prepareFirmware() (errs []error) {
+	switch c.Firmware {
+	case "":
+		if c.EnrolledKeys {
+			errs = append(errs, fmt.Errorf("enrolled_keys requires firmware to be efi"))
+		}
+		return
+	case FirmwareBios:
+		if c.SecureBoot || c.EnrolledKeys {
+			errs = append(errs, fmt.Errorf("secure_boot and enrolled_keys require firmware to be efi"))
+		}
+	case FirmwareEfi:
+		if c.EnrolledKeys && !c.SecureBoot {
+			errs = append(errs, fmt.Errorf("enrolled_keys requires secure_boot"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown firmware '%s', must be bios or efi", c.Firmware))
+	}
+
+	if c.LoaderPath != "" || c.NvramTemplate != "" {
+		errs = append(errs, fmt.Errorf("firmware can't be combined with loader_path and nvram_template, libvirt picks them"))
+	}
+
+	return
+}
+
+func (c *Config) prepareSecureBootKeys() (errs []error) {
+	if c.SecureBootKeys == nil {
+		return
+	}
+
+	// libvirt isn't known to accept an NVRAM template while it picks the firmware itself,
+	// so the firmware has to be given with loader_path
+	if c.Firmware != "" {
+		errs = append(errs, fmt.Errorf("secure_boot_keys can't be combined with firmware, set loader_path to a Secure Boot capable OVMF image instead"))
+	}
+	if c.LoaderPath == "" || !c.SecureBoot {
+		errs = append(errs, fmt.Errorf("secure_boot_keys requires loader_path and secure_boot"))
+	}
+	switch c.LoaderType {
+	case "":
+		c.LoaderType = "pflash"
+	case "pflash":
+	default:
+		errs = append(errs, fmt.Errorf("secure_boot_keys requires loader_type to be pflash"))
+	}
+	if c.NvramPath != "" || c.NvramTemplate != "" {
+		errs = append(errs, fmt.Errorf("secure_boot_keys can't be combined with nvram_path and nvram_template, the NVRAM template is generated"))
+	}
+
+	return append(errs, c.SecureBootKeys.Prepare()...)
+}
+
+// updateDomainFirmware lets libvirt select the firmware of the domain by its features
+func (c *Config) updateDomainFirmware(domainDef *libvirtxml.Domain) {
+	if c.Firmware == "" {
+		return
+	}
+
+	domainDef.OS.Firmware = c.Firmware
+
+	if c.Firmware != FirmwareEfi {
+		return
+	}
+
+	// Both features are always stated, otherwise libvirt might pick any firmware
+	domainDef.OS.FirmwareInfo = &libvirtxml.DomainOSFirmwareInfo{
+		Features: []libvirtxml.DomainOSFirmwareFeature{
+			{Name: "secure-boot", Enabled: yesNo(c.SecureBoot)},
+			{Name: "enrolled-keys", Enabled: yesNo(c.EnrolledKeys)},
+		},
+	}
+
+	if c.SecureBoot {
+		domainDef.OS.Loader = &libvirtxml.DomainLoader{Secure: "yes"}
+		domainDef.Features.SMM = &libvirtxml.DomainFeatureSMM{
+			State: "on",
+		}
+	}
+}
+
+// checkFirmwareCapabilities reports what the domain capabilities of the host lack for the requested firmware
+func (c *Config) checkFirmwareCapabilities(caps *libvirtxml.DomainCaps) error {
+	machine := caps.Machine
+	if machine == "" {
+		machine = c.Chipset
+	}
+
+	if caps.OS == nil || caps.OS.Supported != "yes" {
+		return fmt.Errorf("the host can't select firmware for %s domains of machine type %s", caps.Arch, machine)
+	}
+
+	if firmwares, ok := domainCapsEnum(caps.OS.Enums, "firmware"); ok && !libvirtutils.ContainsString(firmwares, c.Firmware) {
+		return fmt.Errorf("no %s firmware is installed on the host for %s domains of machine type %s", c.Firmware, caps.Arch, machine)
+	}
+
+	if c.Firmware == FirmwareEfi && c.SecureBoot && caps.OS.Loader != nil {
+		if secure, ok := domainCapsEnum(caps.OS.Loader.Enums, "secure"); ok && !libvirtutils.ContainsString(secure, "yes") {
+			return fmt.Errorf("no Secure Boot capable firmware is available for machine type %s, Secure Boot usually requires chipset to be a q35 machine", machine)
+		}
+	}
+
+	return nil
+}
+
+func domainCapsEnum(enums []libvirtxml.DomainCapsEnum, name string) ([]string, bool) {
+	for _, enum := range enums {
+		if enum.Name == name {
+			return enum.Values, true
+		}
+	}
+	return nil, false
+}
+
+func yesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
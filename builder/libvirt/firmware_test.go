@@ -0,0 +1,87 @@
+package libvirt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestCertificate(t *testing.T) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %s", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %s", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "cert.pem")
+	if err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	return path
+}
+
+func TestPrepareSecureBootKeys(t *testing.T) {
+	cert := writeTestCertificate(t)
+
+	tests := []struct {
+		name   string
+		config Config
+		fails  bool
+	}{
+		{
+			name:   "loader_path",
+			config: Config{LoaderPath: "/usr/share/OVMF/OVMF_CODE_4M.secboot.fd", SecureBoot: true},
+		},
+		{
+			name:   "firmware autoselection",
+			config: Config{Firmware: FirmwareEfi, SecureBoot: true},
+			fails:  true,
+		},
+		{
+			name:   "without secure_boot",
+			config: Config{LoaderPath: "/usr/share/OVMF/OVMF_CODE_4M.secboot.fd"},
+			fails:  true,
+		},
+		{
+			name:   "rom loader",
+			config: Config{LoaderPath: "/usr/share/OVMF/OVMF_CODE_4M.secboot.fd", LoaderType: "rom", SecureBoot: true},
+			fails:  true,
+		},
+		{
+			name:   "nvram_template",
+			config: Config{LoaderPath: "/usr/share/OVMF/OVMF_CODE_4M.secboot.fd", NvramTemplate: "/tmp/VARS.fd", SecureBoot: true},
+			fails:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		config := tt.config
+		config.SecureBootKeys = &SecureBootKeys{PK: cert, KEK: []string{cert}, Db: []string{cert}}
+
+		errs := config.prepareSecureBootKeys()
+		if (len(errs) > 0) != tt.fails {
+			t.Errorf("%s: expected failure %t, got %v", tt.name, tt.fails, errs)
+		}
+		if !tt.fails && config.LoaderType != "pflash" {
+			t.Errorf("%s: expected loader_type to default to pflash, got %s", tt.name, config.LoaderType)
+		}
+	}
+}
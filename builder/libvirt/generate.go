@@ -1,3 +1,3 @@
 package libvirt
 
-//go:generate go run github.com/hashicorp/packer-plugin-sdk/cmd/packer-sdc mapstructure-to-hcl2 -type Config,DomainGraphic
+//go:generate go run github.com/hashicorp/packer-plugin-sdk/cmd/packer-sdc mapstructure-to-hcl2 -type Config,DomainGraphic,ArtifactRetention,CreatePool,DiskController,PxeNetwork,SecureBootKeys
@@ -10,6 +10,35 @@ import (
 	"github.com/zclconf/go-cty/cty"
 )
 
+// FlatArtifactRetention is an auto-generated flat version of ArtifactRetention.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatArtifactRetention struct {
+	NamePrefix      *string `mapstructure:"name_prefix" required:"false" cty:"name_prefix" hcl:"name_prefix"`
+	NameRegex       *string `mapstructure:"name_regex" required:"false" cty:"name_regex" hcl:"name_regex"`
+	KeepLast        *int    `mapstructure:"keep_last" required:"false" cty:"keep_last" hcl:"keep_last"`
+	KeepYoungerThan *string `mapstructure:"keep_younger_than" required:"false" cty:"keep_younger_than" hcl:"keep_younger_than"`
+}
+
+// FlatMapstructure returns a new FlatArtifactRetention.
+// FlatArtifactRetention is an auto-generated flat version of ArtifactRetention.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*ArtifactRetention) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatArtifactRetention)
+}
+
+// HCL2Spec returns the hcl spec of a ArtifactRetention.
+// This spec is used by HCL to read the fields of ArtifactRetention.
+// The decoded values from this spec will then be applied to a FlatArtifactRetention.
+func (*FlatArtifactRetention) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"name_prefix":       &hcldec.AttrSpec{Name: "name_prefix", Type: cty.String, Required: false},
+		"name_regex":        &hcldec.AttrSpec{Name: "name_regex", Type: cty.String, Required: false},
+		"keep_last":         &hcldec.AttrSpec{Name: "keep_last", Type: cty.Number, Required: false},
+		"keep_younger_than": &hcldec.AttrSpec{Name: "keep_younger_than", Type: cty.String, Required: false},
+	}
+	return s
+}
+
 // FlatConfig is an auto-generated flat version of Config.
 // Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
 type FlatConfig struct {
@@ -26,15 +55,35 @@ type FlatConfig struct {
 	BootWait              *string                        `mapstructure:"boot_wait" cty:"boot_wait" hcl:"boot_wait"`
 	BootCommand           []string                       `mapstructure:"boot_command" cty:"boot_command" hcl:"boot_command"`
 	KeyHoldType           *string                        `mapstructure:"key_hold_time" cty:"key_hold_time" hcl:"key_hold_time"`
+	Kernel                *string                        `mapstructure:"kernel" required:"false" cty:"kernel" hcl:"kernel"`
+	Initrd                *string                        `mapstructure:"initrd" required:"false" cty:"initrd" hcl:"initrd"`
+	Cmdline               *string                        `mapstructure:"cmdline" required:"false" cty:"cmdline" hcl:"cmdline"`
+	Dtb                   *string                        `mapstructure:"dtb" required:"false" cty:"dtb" hcl:"dtb"`
+	BootFilesPool         *string                        `mapstructure:"boot_files_pool" required:"false" cty:"boot_files_pool" hcl:"boot_files_pool"`
+	HTTPDir               *string                        `mapstructure:"http_directory" cty:"http_directory" hcl:"http_directory"`
+	HTTPContent           map[string]string              `mapstructure:"http_content" cty:"http_content" hcl:"http_content"`
+	HTTPPortMin           *int                           `mapstructure:"http_port_min" cty:"http_port_min" hcl:"http_port_min"`
+	HTTPPortMax           *int                           `mapstructure:"http_port_max" cty:"http_port_max" hcl:"http_port_max"`
+	HTTPAddress           *string                        `mapstructure:"http_bind_address" cty:"http_bind_address" hcl:"http_bind_address"`
+	HTTPInterface         *string                        `mapstructure:"http_interface" undocumented:"true" cty:"http_interface" hcl:"http_interface"`
 	DomainName            *string                        `mapstructure:"domain_name" required:"false" cty:"domain_name" hcl:"domain_name"`
+	DomainOnConflict      *string                        `mapstructure:"domain_on_conflict" required:"false" cty:"domain_on_conflict" hcl:"domain_on_conflict"`
 	MemorySize            *int                           `mapstructure:"memory" required:"false" cty:"memory" hcl:"memory"`
 	CpuCount              *int                           `mapstructure:"vcpu" required:"false" cty:"vcpu" hcl:"vcpu"`
 	CpuMode               *string                        `mapstructure:"cpu_mode" required:"false" cty:"cpu_mode" hcl:"cpu_mode"`
 	NetworkInterfaces     []network.FlatNetworkInterface `mapstructure:"network_interface" required:"false" cty:"network_interface" hcl:"network_interface"`
+	PxeNetwork            *FlatPxeNetwork                `mapstructure:"pxe_network" required:"false" cty:"pxe_network" hcl:"pxe_network"`
 	CommunicatorInterface *string                        `mapstructure:"communicator_interface" required:"false" cty:"communicator_interface" hcl:"communicator_interface"`
 	Volumes               []volume.FlatVolume            `mapstructure:"volume" required:"false" cty:"volume" hcl:"volume"`
+	Controllers           []FlatDiskController           `mapstructure:"controller" required:"false" cty:"controller" hcl:"controller"`
 	ArtifactVolumeAlias   *string                        `mapstructure:"artifact_volume_alias" required:"false" cty:"artifact_volume_alias" hcl:"artifact_volume_alias"`
+	VolumeParallelism     *int                           `mapstructure:"volume_parallelism" required:"false" cty:"volume_parallelism" hcl:"volume_parallelism"`
+	SkipPoolCapacityCheck *bool                          `mapstructure:"skip_pool_capacity_check" required:"false" cty:"skip_pool_capacity_check" hcl:"skip_pool_capacity_check"`
+	AllowPoolOvercommit   *bool                          `mapstructure:"allow_pool_overcommit" required:"false" cty:"allow_pool_overcommit" hcl:"allow_pool_overcommit"`
+	CreatePools           []FlatCreatePool               `mapstructure:"create_pool" required:"false" cty:"create_pool" hcl:"create_pool"`
+	ArtifactRetention     *FlatArtifactRetention         `mapstructure:"artifact_retention" required:"false" cty:"artifact_retention" hcl:"artifact_retention"`
 	BootDevices           []string                       `mapstructure:"boot_devices" required:"false" cty:"boot_devices" hcl:"boot_devices"`
+	EjectOnReboot         []string                       `mapstructure:"eject_on_reboot" required:"false" cty:"eject_on_reboot" hcl:"eject_on_reboot"`
 	DomainGraphics        []FlatDomainGraphic            `mapstructure:"graphics" required:"false" cty:"graphics" hcl:"graphics"`
 	NetworkAddressSource  *string                        `mapstructure:"network_address_source" required:"false" cty:"network_address_source" hcl:"network_address_source"`
 	LibvirtURI            *string                        `mapstructure:"libvirt_uri" required:"true" cty:"libvirt_uri" hcl:"libvirt_uri"`
@@ -43,11 +92,14 @@ type FlatConfig struct {
 	DomainType            *string                        `mapstructure:"domain_type" required:"false" cty:"domain_type" hcl:"domain_type"`
 	Arch                  *string                        `mapstructure:"arch" required:"false" cty:"arch" hcl:"arch"`
 	Chipset               *string                        `mapstructure:"chipset" required:"false" cty:"chipset" hcl:"chipset"`
+	Firmware              *string                        `mapstructure:"firmware" required:"false" cty:"firmware" hcl:"firmware"`
+	EnrolledKeys          *bool                          `mapstructure:"enrolled_keys" required:"false" cty:"enrolled_keys" hcl:"enrolled_keys"`
 	LoaderPath            *string                        `mapstructure:"loader_path" required:"false" cty:"loader_path" hcl:"loader_path"`
 	LoaderType            *string                        `mapstructure:"loader_type" required:"false" cty:"loader_type" hcl:"loader_type"`
 	SecureBoot            *bool                          `mapstructure:"secure_boot" required:"false" cty:"secure_boot" hcl:"secure_boot"`
 	NvramPath             *string                        `mapstructure:"nvram_path" required:"false" cty:"nvram_path" hcl:"nvram_path"`
 	NvramTemplate         *string                        `mapstructure:"nvram_template" required:"false" cty:"nvram_template" hcl:"nvram_template"`
+	SecureBootKeys        *FlatSecureBootKeys            `mapstructure:"secure_boot_keys" required:"false" cty:"secure_boot_keys" hcl:"secure_boot_keys"`
 }
 
 // FlatMapstructure returns a new FlatConfig.
@@ -75,15 +127,35 @@ func (*FlatConfig) HCL2Spec() map[string]hcldec.Spec {
 		"boot_wait":                  &hcldec.AttrSpec{Name: "boot_wait", Type: cty.String, Required: false},
 		"boot_command":               &hcldec.AttrSpec{Name: "boot_command", Type: cty.List(cty.String), Required: false},
 		"key_hold_time":              &hcldec.AttrSpec{Name: "key_hold_time", Type: cty.String, Required: false},
+		"kernel":                     &hcldec.AttrSpec{Name: "kernel", Type: cty.String, Required: false},
+		"initrd":                     &hcldec.AttrSpec{Name: "initrd", Type: cty.String, Required: false},
+		"cmdline":                    &hcldec.AttrSpec{Name: "cmdline", Type: cty.String, Required: false},
+		"dtb":                        &hcldec.AttrSpec{Name: "dtb", Type: cty.String, Required: false},
+		"boot_files_pool":            &hcldec.AttrSpec{Name: "boot_files_pool", Type: cty.String, Required: false},
+		"http_directory":             &hcldec.AttrSpec{Name: "http_directory", Type: cty.String, Required: false},
+		"http_content":               &hcldec.AttrSpec{Name: "http_content", Type: cty.Map(cty.String), Required: false},
+		"http_port_min":              &hcldec.AttrSpec{Name: "http_port_min", Type: cty.Number, Required: false},
+		"http_port_max":              &hcldec.AttrSpec{Name: "http_port_max", Type: cty.Number, Required: false},
+		"http_bind_address":          &hcldec.AttrSpec{Name: "http_bind_address", Type: cty.String, Required: false},
+		"http_interface":             &hcldec.AttrSpec{Name: "http_interface", Type: cty.String, Required: false},
 		"domain_name":                &hcldec.AttrSpec{Name: "domain_name", Type: cty.String, Required: false},
+		"domain_on_conflict":         &hcldec.AttrSpec{Name: "domain_on_conflict", Type: cty.String, Required: false},
 		"memory":                     &hcldec.AttrSpec{Name: "memory", Type: cty.Number, Required: false},
 		"vcpu":                       &hcldec.AttrSpec{Name: "vcpu", Type: cty.Number, Required: false},
 		"cpu_mode":                   &hcldec.AttrSpec{Name: "cpu_mode", Type: cty.String, Required: false},
 		"network_interface":          &hcldec.BlockListSpec{TypeName: "network_interface", Nested: hcldec.ObjectSpec((*network.FlatNetworkInterface)(nil).HCL2Spec())},
+		"pxe_network":                &hcldec.BlockSpec{TypeName: "pxe_network", Nested: hcldec.ObjectSpec((*FlatPxeNetwork)(nil).HCL2Spec())},
 		"communicator_interface":     &hcldec.AttrSpec{Name: "communicator_interface", Type: cty.String, Required: false},
 		"volume":                     &hcldec.BlockListSpec{TypeName: "volume", Nested: hcldec.ObjectSpec((*volume.FlatVolume)(nil).HCL2Spec())},
+		"controller":                 &hcldec.BlockListSpec{TypeName: "controller", Nested: hcldec.ObjectSpec((*FlatDiskController)(nil).HCL2Spec())},
 		"artifact_volume_alias":      &hcldec.AttrSpec{Name: "artifact_volume_alias", Type: cty.String, Required: false},
+		"volume_parallelism":         &hcldec.AttrSpec{Name: "volume_parallelism", Type: cty.Number, Required: false},
+		"skip_pool_capacity_check":   &hcldec.AttrSpec{Name: "skip_pool_capacity_check", Type: cty.Bool, Required: false},
+		"allow_pool_overcommit":      &hcldec.AttrSpec{Name: "allow_pool_overcommit", Type: cty.Bool, Required: false},
+		"create_pool":                &hcldec.BlockListSpec{TypeName: "create_pool", Nested: hcldec.ObjectSpec((*FlatCreatePool)(nil).HCL2Spec())},
+		"artifact_retention":         &hcldec.BlockSpec{TypeName: "artifact_retention", Nested: hcldec.ObjectSpec((*FlatArtifactRetention)(nil).HCL2Spec())},
 		"boot_devices":               &hcldec.AttrSpec{Name: "boot_devices", Type: cty.List(cty.String), Required: false},
+		"eject_on_reboot":            &hcldec.AttrSpec{Name: "eject_on_reboot", Type: cty.List(cty.String), Required: false},
 		"graphics":                   &hcldec.BlockListSpec{TypeName: "graphics", Nested: hcldec.ObjectSpec((*FlatDomainGraphic)(nil).HCL2Spec())},
 		"network_address_source":     &hcldec.AttrSpec{Name: "network_address_source", Type: cty.String, Required: false},
 		"libvirt_uri":                &hcldec.AttrSpec{Name: "libvirt_uri", Type: cty.String, Required: false},
@@ -92,11 +164,74 @@ func (*FlatConfig) HCL2Spec() map[string]hcldec.Spec {
 		"domain_type":                &hcldec.AttrSpec{Name: "domain_type", Type: cty.String, Required: false},
 		"arch":                       &hcldec.AttrSpec{Name: "arch", Type: cty.String, Required: false},
 		"chipset":                    &hcldec.AttrSpec{Name: "chipset", Type: cty.String, Required: false},
+		"firmware":                   &hcldec.AttrSpec{Name: "firmware", Type: cty.String, Required: false},
+		"enrolled_keys":              &hcldec.AttrSpec{Name: "enrolled_keys", Type: cty.Bool, Required: false},
 		"loader_path":                &hcldec.AttrSpec{Name: "loader_path", Type: cty.String, Required: false},
 		"loader_type":                &hcldec.AttrSpec{Name: "loader_type", Type: cty.String, Required: false},
 		"secure_boot":                &hcldec.AttrSpec{Name: "secure_boot", Type: cty.Bool, Required: false},
 		"nvram_path":                 &hcldec.AttrSpec{Name: "nvram_path", Type: cty.String, Required: false},
 		"nvram_template":             &hcldec.AttrSpec{Name: "nvram_template", Type: cty.String, Required: false},
+		"secure_boot_keys":           &hcldec.BlockSpec{TypeName: "secure_boot_keys", Nested: hcldec.ObjectSpec((*FlatSecureBootKeys)(nil).HCL2Spec())},
+	}
+	return s
+}
+
+// FlatCreatePool is an auto-generated flat version of CreatePool.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatCreatePool struct {
+	Name             *string `mapstructure:"name" required:"false" cty:"name" hcl:"name"`
+	Type             *string `mapstructure:"type" required:"false" cty:"type" hcl:"type"`
+	Path             *string `mapstructure:"path" required:"true" cty:"path" hcl:"path"`
+	Persistent       *bool   `mapstructure:"persistent" required:"false" cty:"persistent" hcl:"persistent"`
+	DestroyOnCleanup *bool   `mapstructure:"destroy_on_cleanup" required:"false" cty:"destroy_on_cleanup" hcl:"destroy_on_cleanup"`
+}
+
+// FlatMapstructure returns a new FlatCreatePool.
+// FlatCreatePool is an auto-generated flat version of CreatePool.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*CreatePool) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatCreatePool)
+}
+
+// HCL2Spec returns the hcl spec of a CreatePool.
+// This spec is used by HCL to read the fields of CreatePool.
+// The decoded values from this spec will then be applied to a FlatCreatePool.
+func (*FlatCreatePool) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"name":               &hcldec.AttrSpec{Name: "name", Type: cty.String, Required: false},
+		"type":               &hcldec.AttrSpec{Name: "type", Type: cty.String, Required: false},
+		"path":               &hcldec.AttrSpec{Name: "path", Type: cty.String, Required: false},
+		"persistent":         &hcldec.AttrSpec{Name: "persistent", Type: cty.Bool, Required: false},
+		"destroy_on_cleanup": &hcldec.AttrSpec{Name: "destroy_on_cleanup", Type: cty.Bool, Required: false},
+	}
+	return s
+}
+
+// FlatDiskController is an auto-generated flat version of DiskController.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatDiskController struct {
+	Type     *string `mapstructure:"type" required:"true" cty:"type" hcl:"type"`
+	Model    *string `mapstructure:"model" required:"false" cty:"model" hcl:"model"`
+	Queues   *uint   `mapstructure:"queues" required:"false" cty:"queues" hcl:"queues"`
+	IOThread *uint   `mapstructure:"iothread" required:"false" cty:"iothread" hcl:"iothread"`
+}
+
+// FlatMapstructure returns a new FlatDiskController.
+// FlatDiskController is an auto-generated flat version of DiskController.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*DiskController) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatDiskController)
+}
+
+// HCL2Spec returns the hcl spec of a DiskController.
+// This spec is used by HCL to read the fields of DiskController.
+// The decoded values from this spec will then be applied to a FlatDiskController.
+func (*FlatDiskController) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"type":     &hcldec.AttrSpec{Name: "type", Type: cty.String, Required: false},
+		"model":    &hcldec.AttrSpec{Name: "model", Type: cty.String, Required: false},
+		"queues":   &hcldec.AttrSpec{Name: "queues", Type: cty.Number, Required: false},
+		"iothread": &hcldec.AttrSpec{Name: "iothread", Type: cty.Number, Required: false},
 	}
 	return s
 }
@@ -127,3 +262,73 @@ func (*FlatDomainGraphic) HCL2Spec() map[string]hcldec.Spec {
 	}
 	return s
 }
+
+// FlatPxeNetwork is an auto-generated flat version of PxeNetwork.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatPxeNetwork struct {
+	Name         *string `mapstructure:"name" required:"false" cty:"name" hcl:"name"`
+	Address      *string `mapstructure:"address" required:"false" cty:"address" hcl:"address"`
+	TftpRoot     *string `mapstructure:"tftp_root" required:"false" cty:"tftp_root" hcl:"tftp_root"`
+	BootFile     *string `mapstructure:"boot_file" required:"false" cty:"boot_file" hcl:"boot_file"`
+	HttpBootFile *string `mapstructure:"http_boot_file" required:"false" cty:"http_boot_file" hcl:"http_boot_file"`
+	HttpHost     *string `mapstructure:"http_host" required:"false" cty:"http_host" hcl:"http_host"`
+	Isolated     *bool   `mapstructure:"isolated" required:"false" cty:"isolated" hcl:"isolated"`
+	BootOrder    *uint   `mapstructure:"boot_order" required:"false" cty:"boot_order" hcl:"boot_order"`
+}
+
+// FlatMapstructure returns a new FlatPxeNetwork.
+// FlatPxeNetwork is an auto-generated flat version of PxeNetwork.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*PxeNetwork) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatPxeNetwork)
+}
+
+// HCL2Spec returns the hcl spec of a PxeNetwork.
+// This spec is used by HCL to read the fields of PxeNetwork.
+// The decoded values from this spec will then be applied to a FlatPxeNetwork.
+func (*FlatPxeNetwork) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"name":           &hcldec.AttrSpec{Name: "name", Type: cty.String, Required: false},
+		"address":        &hcldec.AttrSpec{Name: "address", Type: cty.String, Required: false},
+		"tftp_root":      &hcldec.AttrSpec{Name: "tftp_root", Type: cty.String, Required: false},
+		"boot_file":      &hcldec.AttrSpec{Name: "boot_file", Type: cty.String, Required: false},
+		"http_boot_file": &hcldec.AttrSpec{Name: "http_boot_file", Type: cty.String, Required: false},
+		"http_host":      &hcldec.AttrSpec{Name: "http_host", Type: cty.String, Required: false},
+		"isolated":       &hcldec.AttrSpec{Name: "isolated", Type: cty.Bool, Required: false},
+		"boot_order":     &hcldec.AttrSpec{Name: "boot_order", Type: cty.Number, Required: false},
+	}
+	return s
+}
+
+// FlatSecureBootKeys is an auto-generated flat version of SecureBootKeys.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatSecureBootKeys struct {
+	PK        *string  `mapstructure:"pk" required:"true" cty:"pk" hcl:"pk"`
+	KEK       []string `mapstructure:"kek" required:"true" cty:"kek" hcl:"kek"`
+	Db        []string `mapstructure:"db" required:"true" cty:"db" hcl:"db"`
+	OwnerGuid *string  `mapstructure:"owner_guid" required:"false" cty:"owner_guid" hcl:"owner_guid"`
+	FlashSize *string  `mapstructure:"flash_size" required:"false" cty:"flash_size" hcl:"flash_size"`
+	Pool      *string  `mapstructure:"pool" required:"false" cty:"pool" hcl:"pool"`
+}
+
+// FlatMapstructure returns a new FlatSecureBootKeys.
+// FlatSecureBootKeys is an auto-generated flat version of SecureBootKeys.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*SecureBootKeys) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatSecureBootKeys)
+}
+
+// HCL2Spec returns the hcl spec of a SecureBootKeys.
+// This spec is used by HCL to read the fields of SecureBootKeys.
+// The decoded values from this spec will then be applied to a FlatSecureBootKeys.
+func (*FlatSecureBootKeys) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"pk":         &hcldec.AttrSpec{Name: "pk", Type: cty.String, Required: false},
+		"kek":        &hcldec.AttrSpec{Name: "kek", Type: cty.List(cty.String), Required: false},
+		"db":         &hcldec.AttrSpec{Name: "db", Type: cty.List(cty.String), Required: false},
+		"owner_guid": &hcldec.AttrSpec{Name: "owner_guid", Type: cty.String, Required: false},
+		"flash_size": &hcldec.AttrSpec{Name: "flash_size", Type: cty.String, Required: false},
+		"pool":       &hcldec.AttrSpec{Name: "pool", Type: cty.String, Required: false},
+	}
+	return s
+}
@@ -22,6 +22,9 @@ type NetworkInterface struct {
 	// Typical values for QEMU and KVM include: `ne2k_isa` `i82551` `i82557b` `i82559er` `ne2k_pci` `pcnet` `rtl8139` `e1000` `virtio`.
 	// If nothing is specified, `virtio` will be used as a default.
 	Model string `mapstructure:"model" required:"false"`
+	// [optional] The position of the interface in the boot order of the domain, starting from 1, to boot it over PXE.
+	// Can't be combined with `boot_devices`.
+	BootOrder uint `mapstructure:"boot_order" required:"false"`
 
 	Bridge  BridgeNetworkInterface  `mapstructure:",squash"`
 	Managed ManagedNetworkInterface `mapstructure:",squash"`
@@ -67,6 +70,9 @@ func (ni NetworkInterface) DomainInterface() *libvirtxml.DomainInterface {
 			Address: ni.Mac,
 		}
 	}
+	if ni.BootOrder != 0 {
+		domainInterface.Boot = &libvirtxml.DomainDeviceBoot{Order: ni.BootOrder}
+	}
 	if ni.Alias != "" {
 		domainInterface.Alias = &libvirtxml.DomainAlias{
 			Name: ni.Alias,
@@ -0,0 +1,66 @@
+package nvram
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Guid is an EFI_GUID in its binary representation:
+// the first three fields are little endian, the last eight bytes are stored as they are.
+type Guid [16]byte
+
+// ParseGuid parses a GUID in its textual form, like 8be4df61-93ca-11d2-aa0d-00e098032b8c
+func ParseGuid(s string) (Guid, error) {
+	guid := Guid{}
+
+	parts := strings.Split(s, "-")
+	if len(parts) != 5 || len(parts[0]) != 8 || len(parts[1]) != 4 || len(parts[2]) != 4 || len(parts[3]) != 4 || len(parts[4]) != 12 {
+		return guid, fmt.Errorf("%s is not a valid GUID", s)
+	}
+
+	raw, err := hex.DecodeString(strings.Join(parts, ""))
+	if err != nil {
+		return guid, fmt.Errorf("%s is not a valid GUID: %s", s, err)
+	}
+
+	binary.LittleEndian.PutUint32(guid[0:], binary.BigEndian.Uint32(raw[0:]))
+	binary.LittleEndian.PutUint16(guid[4:], binary.BigEndian.Uint16(raw[4:]))
+	binary.LittleEndian.PutUint16(guid[6:], binary.BigEndian.Uint16(raw[6:]))
+	copy(guid[8:], raw[8:])
+
+	return guid, nil
+}
+
+// MustParseGuid is like ParseGuid but panics if the GUID can't be parsed
+func MustParseGuid(s string) Guid {
+	guid, err := ParseGuid(s)
+	if err != nil {
+		panic(err)
+	}
+	return guid
+}
+
+// NewRandomGuid creates a random (version 4) GUID
+func NewRandomGuid() (Guid, error) {
+	guid := Guid{}
+	if _, err := rand.Read(guid[:]); err != nil {
+		return guid, err
+	}
+	// The version lives in the high nibble of the third, little endian field
+	guid[7] = (guid[7] & 0x0f) | 0x40
+	guid[8] = (guid[8] & 0x3f) | 0x80
+	return guid, nil
+}
+
+func (guid Guid) String() string {
+	return fmt.Sprintf("%08x-%04x-%04x-%x-%x",
+		binary.LittleEndian.Uint32(guid[0:]),
+		binary.LittleEndian.Uint16(guid[4:]),
+		binary.LittleEndian.Uint16(guid[6:]),
+		guid[8:10],
+		guid[10:],
+	)
+}
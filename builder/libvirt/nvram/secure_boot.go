@@ -0,0 +1,49 @@
+package nvram
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+)
+
+// SecureBootKeys are the X.509 certificates, in DER encoding, enrolled into the variable store
+type SecureBootKeys struct {
+	PK    []byte
+	KEK   [][]byte
+	Db    [][]byte
+	Owner Guid
+}
+
+const authenticatedVariableAttributes = AttributeNonVolatile | AttributeBootServiceAccess |
+	AttributeRuntimeAccess | AttributeTimeBasedAuthenticatedWriteAccess
+
+// Variables returns the variables enrolling the keys and enabling Secure Boot
+func (keys SecureBootKeys) Variables() []Variable {
+	return []Variable{
+		{Name: "PK", Vendor: GlobalVariableGuid, Attributes: authenticatedVariableAttributes, Data: keys.signatureLists([][]byte{keys.PK})},
+		{Name: "KEK", Vendor: GlobalVariableGuid, Attributes: authenticatedVariableAttributes, Data: keys.signatureLists(keys.KEK)},
+		{Name: "db", Vendor: ImageSecurityDatabaseGuid, Attributes: authenticatedVariableAttributes, Data: keys.signatureLists(keys.Db)},
+		{Name: "SecureBootEnable", Vendor: SecureBootEnableDisableGuid, Attributes: AttributeNonVolatile | AttributeBootServiceAccess, Data: []byte{1}},
+		{Name: "CustomMode", Vendor: CustomModeEnableGuid, Attributes: AttributeNonVolatile | AttributeBootServiceAccess, Data: []byte{0}},
+	}
+}
+
+// GenerateSecureBootVariableStore creates a variable store with the keys enrolled and Secure Boot enabled
+func GenerateSecureBootVariableStore(layout Layout, keys SecureBootKeys, timestamp time.Time) ([]byte, error) {
+	return Generate(layout, keys.Variables(), timestamp)
+}
+
+// signatureLists creates an EFI_SIGNATURE_LIST for each certificate
+func (keys SecureBootKeys) signatureLists(certificates [][]byte) []byte {
+	lists := &bytes.Buffer{}
+	for _, certificate := range certificates {
+		signatureSize := len(keys.Owner) + len(certificate)
+		lists.Write(certX509Guid[:])
+		binary.Write(lists, binary.LittleEndian, uint32(len(certX509Guid)+12+signatureSize))
+		binary.Write(lists, binary.LittleEndian, uint32(0)) // signature header size
+		binary.Write(lists, binary.LittleEndian, uint32(signatureSize))
+		lists.Write(keys.Owner[:])
+		lists.Write(certificate)
+	}
+	return lists.Bytes()
+}
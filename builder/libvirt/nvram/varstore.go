@@ -0,0 +1,203 @@
+// Package nvram generates OVMF variable stores with Secure Boot keys enrolled,
+// without relying on tools like virt-fw-vars on the machine running Packer.
+//
+// The layout follows OvmfPkg/VarStore.fdf.inc of EDK II: a firmware volume holding the
+// authenticated variable store, followed by the event log, the fault tolerant write working block and its spare.
+package nvram
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+	"unicode/utf16"
+)
+
+// Layout describes the regions of the variable store of an OVMF build
+type Layout struct {
+	// The size of the firmware volume holding the variables
+	VariableStoreSize int
+	// The size of the whole variable store file, matching the flash size of the firmware
+	TotalSize int
+}
+
+var (
+	// The layout of the 4 MiB OVMF builds, like OVMF_VARS_4M.fd
+	Layout4M = Layout{VariableStoreSize: 0x40000, TotalSize: 0x84000}
+	// The layout of the 2 MiB OVMF builds, like OVMF_VARS.fd
+	Layout2M = Layout{VariableStoreSize: 0xe000, TotalSize: 0x20000}
+)
+
+const (
+	eventLogSize       = 0x1000
+	ftwWorkingSize     = 0x1000
+	fvHeaderSize       = 0x48
+	storeHeaderSize    = 28
+	variableHeaderSize = 60
+	blockSize          = 0x1000
+
+	variableStartId = 0x55aa
+	variableAdded   = 0x3f
+
+	storeFormatted = 0x5a
+	storeHealthy   = 0xfe
+)
+
+// Variable attributes, see the UEFI specification
+const (
+	AttributeNonVolatile                       = 0x01
+	AttributeBootServiceAccess                 = 0x02
+	AttributeRuntimeAccess                     = 0x04
+	AttributeTimeBasedAuthenticatedWriteAccess = 0x20
+)
+
+var (
+	systemNvDataFvGuid          = MustParseGuid("fff12b8d-7696-4c8b-a985-2747075b4f50")
+	authenticatedVariableGuid   = MustParseGuid("aaf32c78-947b-439a-a180-2e144ec37792")
+	workingBlockSignatureGuid   = MustParseGuid("9e58292b-7c68-497d-a0ce-6500fd9f1b95")
+	GlobalVariableGuid          = MustParseGuid("8be4df61-93ca-11d2-aa0d-00e098032b8c")
+	ImageSecurityDatabaseGuid   = MustParseGuid("d719b2cb-3d3a-4596-a3bc-dad00e67656f")
+	SecureBootEnableDisableGuid = MustParseGuid("f0a30bc7-af08-4556-99c4-001009c93a44")
+	CustomModeEnableGuid        = MustParseGuid("c076ec0c-7028-4399-a072-71ee5c448b9f")
+	certX509Guid                = MustParseGuid("a5c059a1-94e4-4aa7-87b5-ab155c2bf072")
+)
+
+// Variable is a UEFI variable stored in the variable store
+type Variable struct {
+	Name       string
+	Vendor     Guid
+	Attributes uint32
+	Data       []byte
+}
+
+// Generate creates a variable store file with the given variables
+func Generate(layout Layout, variables []Variable, timestamp time.Time) ([]byte, error) {
+	buf := bytes.Repeat([]byte{0xff}, layout.TotalSize)
+
+	copy(buf, firmwareVolumeHeader(layout))
+	copy(buf[fvHeaderSize:], variableStoreHeader(layout))
+
+	offset := fvHeaderSize + storeHeaderSize
+	for _, variable := range variables {
+		encoded := encodeVariable(variable, timestamp)
+		if offset+len(encoded) > layout.VariableStoreSize {
+			return nil, fmt.Errorf("the variables don't fit into the %d bytes of the variable store", layout.VariableStoreSize)
+		}
+		copy(buf[offset:], encoded)
+		offset = alignUp(offset+len(encoded), 4)
+	}
+
+	copy(buf[layout.VariableStoreSize+eventLogSize:], ftwWorkingBlockHeader())
+
+	return buf, nil
+}
+
+func firmwareVolumeHeader(layout Layout) []byte {
+	header := &bytes.Buffer{}
+	header.Write(make([]byte, 16))
+	header.Write(systemNvDataFvGuid[:])
+	binary.Write(header, binary.LittleEndian, uint64(layout.TotalSize))
+	header.WriteString("_FVH")
+	binary.Write(header, binary.LittleEndian, uint32(0x0004feff))
+	binary.Write(header, binary.LittleEndian, uint16(fvHeaderSize))
+	binary.Write(header, binary.LittleEndian, uint16(0)) // checksum, filled in below
+	binary.Write(header, binary.LittleEndian, uint16(0)) // ext header offset
+	header.WriteByte(0)                                  // reserved
+	header.WriteByte(2)                                  // revision
+	binary.Write(header, binary.LittleEndian, uint32(layout.TotalSize/blockSize))
+	binary.Write(header, binary.LittleEndian, uint32(blockSize))
+	header.Write(make([]byte, 8)) // end of the block map
+
+	raw := header.Bytes()
+	binary.LittleEndian.PutUint16(raw[0x32:], fvHeaderChecksum(raw))
+	return raw
+}
+
+// fvHeaderChecksum makes the 16 bit words of the header sum up to zero
+func fvHeaderChecksum(header []byte) uint16 {
+	var sum uint16
+	for i := 0; i+1 < len(header); i += 2 {
+		sum += binary.LittleEndian.Uint16(header[i:])
+	}
+	return -sum
+}
+
+func variableStoreHeader(layout Layout) []byte {
+	header := &bytes.Buffer{}
+	header.Write(authenticatedVariableGuid[:])
+	binary.Write(header, binary.LittleEndian, uint32(layout.VariableStoreSize-fvHeaderSize))
+	header.WriteByte(storeFormatted)
+	header.WriteByte(storeHealthy)
+	header.Write(make([]byte, 6))
+	return header.Bytes()
+}
+
+func ftwWorkingBlockHeader() []byte {
+	header := &bytes.Buffer{}
+	header.Write(workingBlockSignatureGuid[:])
+	// The CRC of the header as written by OVMF's build, valid for a 4 KiB working block
+	binary.Write(header, binary.LittleEndian, uint32(0x642caf2c))
+	// WorkingBlockValid set, WorkingBlockInvalid clear, with an erase polarity of 1
+	header.Write([]byte{0xfe, 0xff, 0xff, 0xff})
+	binary.Write(header, binary.LittleEndian, uint64(ftwWorkingSize-32))
+	return header.Bytes()
+}
+
+// encodeVariable creates an AUTHENTICATED_VARIABLE_HEADER followed by the name and the data of the variable
+func encodeVariable(variable Variable, timestamp time.Time) []byte {
+	name := encodeName(variable.Name)
+
+	encoded := &bytes.Buffer{}
+	binary.Write(encoded, binary.LittleEndian, uint16(variableStartId))
+	encoded.WriteByte(variableAdded)
+	encoded.WriteByte(0)
+	binary.Write(encoded, binary.LittleEndian, variable.Attributes)
+	binary.Write(encoded, binary.LittleEndian, uint64(0)) // monotonic count
+
+	if variable.Attributes&AttributeTimeBasedAuthenticatedWriteAccess != 0 {
+		encoded.Write(efiTime(timestamp))
+	} else {
+		encoded.Write(make([]byte, 16))
+	}
+
+	binary.Write(encoded, binary.LittleEndian, uint32(0)) // public key index
+	binary.Write(encoded, binary.LittleEndian, uint32(len(name)))
+	binary.Write(encoded, binary.LittleEndian, uint32(len(variable.Data)))
+	encoded.Write(variable.Vendor[:])
+	encoded.Write(name)
+	encoded.Write(variable.Data)
+
+	return encoded.Bytes()
+}
+
+// encodeName encodes the name of a variable as a null terminated UTF-16LE string
+func encodeName(name string) []byte {
+	encoded := &bytes.Buffer{}
+	for _, c := range utf16.Encode([]rune(name)) {
+		binary.Write(encoded, binary.LittleEndian, c)
+	}
+	binary.Write(encoded, binary.LittleEndian, uint16(0))
+	return encoded.Bytes()
+}
+
+// efiTime encodes an EFI_TIME in UTC
+func efiTime(t time.Time) []byte {
+	t = t.UTC()
+	encoded := &bytes.Buffer{}
+	binary.Write(encoded, binary.LittleEndian, uint16(t.Year()))
+	encoded.WriteByte(byte(t.Month()))
+	encoded.WriteByte(byte(t.Day()))
+	encoded.WriteByte(byte(t.Hour()))
+	encoded.WriteByte(byte(t.Minute()))
+	encoded.WriteByte(byte(t.Second()))
+	encoded.WriteByte(0)                                  // pad
+	binary.Write(encoded, binary.LittleEndian, uint32(0)) // nanoseconds
+	binary.Write(encoded, binary.LittleEndian, int16(0))  // time zone
+	encoded.WriteByte(0)                                  // daylight
+	encoded.WriteByte(0)                                  // pad
+	return encoded.Bytes()
+}
+
+func alignUp(value int, alignment int) int {
+	return (value + alignment - 1) / alignment * alignment
+}
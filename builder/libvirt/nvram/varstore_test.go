@@ -0,0 +1,116 @@
+package nvram_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/thomasklein94/packer-plugin-libvirt/builder/libvirt/nvram"
+)
+
+func TestParseGuidRoundTrip(t *testing.T) {
+	text := "8be4df61-93ca-11d2-aa0d-00e098032b8c"
+	guid, err := nvram.ParseGuid(text)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []byte{0x61, 0xdf, 0xe4, 0x8b, 0xca, 0x93, 0xd2, 0x11, 0xaa, 0x0d, 0x00, 0xe0, 0x98, 0x03, 0x2b, 0x8c}
+	if !bytes.Equal(guid[:], expected) {
+		t.Errorf("expected % x, got % x", expected, guid[:])
+	}
+	if guid.String() != text {
+		t.Errorf("expected %s, got %s", text, guid.String())
+	}
+
+	if _, err := nvram.ParseGuid("8be4df61-93ca-11d2-aa0d"); err == nil {
+		t.Errorf("expected an error for a truncated GUID")
+	}
+}
+
+func TestGenerateLayout(t *testing.T) {
+	for name, layout := range map[string]nvram.Layout{"4M": nvram.Layout4M, "2M": nvram.Layout2M} {
+		store, err := nvram.Generate(layout, nil, time.Now())
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", name, err)
+		}
+
+		if len(store) != layout.TotalSize {
+			t.Errorf("%s: expected %d bytes, got %d", name, layout.TotalSize, len(store))
+		}
+		if string(store[0x28:0x2c]) != "_FVH" {
+			t.Errorf("%s: firmware volume signature is missing", name)
+		}
+		if binary.LittleEndian.Uint64(store[0x20:]) != uint64(layout.TotalSize) {
+			t.Errorf("%s: firmware volume length doesn't match the flash size", name)
+		}
+
+		var sum uint16
+		for i := 0; i < 0x48; i += 2 {
+			sum += binary.LittleEndian.Uint16(store[i:])
+		}
+		if sum != 0 {
+			t.Errorf("%s: firmware volume header checksum is invalid", name)
+		}
+
+		if binary.LittleEndian.Uint32(store[0x48+16:]) != uint32(layout.VariableStoreSize-0x48) {
+			t.Errorf("%s: variable store size doesn't match the layout", name)
+		}
+		// The first variable slot is erased
+		if binary.LittleEndian.Uint16(store[0x48+28:]) != 0xffff {
+			t.Errorf("%s: expected an empty variable store", name)
+		}
+	}
+}
+
+func TestGenerateSecureBootVariables(t *testing.T) {
+	keys := nvram.SecureBootKeys{
+		PK:    []byte("pk"),
+		KEK:   [][]byte{[]byte("kek")},
+		Db:    [][]byte{[]byte("db1"), []byte("db2")},
+		Owner: nvram.MustParseGuid("11111111-2222-3333-4444-555555555555"),
+	}
+
+	store, err := nvram.GenerateSecureBootVariableStore(nvram.Layout2M, keys, time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	offset := 0x48 + 28
+	names := []string{}
+	for binary.LittleEndian.Uint16(store[offset:]) == 0x55aa {
+		if store[offset+2] != 0x3f {
+			t.Errorf("variable at %#x is not in added state", offset)
+		}
+		nameSize := int(binary.LittleEndian.Uint32(store[offset+36:]))
+		dataSize := int(binary.LittleEndian.Uint32(store[offset+40:]))
+
+		name := []rune{}
+		for i := 0; i < nameSize-2; i += 2 {
+			name = append(name, rune(binary.LittleEndian.Uint16(store[offset+60+i:])))
+		}
+		names = append(names, string(name))
+
+		if string(name) == "db" {
+			// Each certificate gets its own signature list
+			expected := 2*(16+12+16) + len("db1") + len("db2")
+			if dataSize != expected {
+				t.Errorf("expected %d bytes of db, got %d", expected, dataSize)
+			}
+		}
+
+		offset = (offset + 60 + nameSize + dataSize + 3) / 4 * 4
+	}
+
+	expected := []string{"PK", "KEK", "db", "SecureBootEnable", "CustomMode"}
+	if len(names) != len(expected) {
+		t.Fatalf("expected variables %v, got %v", expected, names)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Errorf("expected variables %v, got %v", expected, names)
+			break
+		}
+	}
+}
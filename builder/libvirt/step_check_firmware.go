@@ -0,0 +1,53 @@
+package libvirt
+
+import (
+	"context"
+	"log"
+
+	libvirt "github.com/digitalocean/go-libvirt"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"libvirt.org/go/libvirtxml"
+)
+
+// stepCheckFirmware makes sure the host has the firmware requested with `firmware` before anything is created,
+// instead of failing when the domain is defined.
+type stepCheckFirmware struct{}
+
+func (s *stepCheckFirmware) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+
+	if config.Firmware == "" {
+		return multistep.ActionContinue
+	}
+
+	ui := state.Get("ui").(packersdk.Ui)
+	driver := state.Get("driver").(*libvirt.Libvirt)
+
+	machine := libvirt.OptString{}
+	if config.Chipset != "" {
+		machine = libvirt.OptString{config.Chipset}
+	}
+
+	rawCaps, err := driver.ConnectGetDomainCapabilities(libvirt.OptString{}, libvirt.OptString{config.Arch}, machine, libvirt.OptString{config.DomainType}, 0)
+	if err != nil {
+		ui.Message("Couldn't get the domain capabilities of the host, the firmware is not checked in advance")
+		log.Printf("ConnectGetDomainCapabilities: %s\n", err)
+		return multistep.ActionContinue
+	}
+
+	caps := &libvirtxml.DomainCaps{}
+	if err := caps.Unmarshal(rawCaps); err != nil {
+		return haltOnError(ui, state, "Error while parsing the domain capabilities of the host: %s", err)
+	}
+
+	if err := config.checkFirmwareCapabilities(caps); err != nil {
+		return haltOnError(ui, state, "%s", err)
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *stepCheckFirmware) Cleanup(state multistep.StateBag) {
+	// Do nothing
+}
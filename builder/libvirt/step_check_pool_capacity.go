@@ -0,0 +1,141 @@
+package libvirt
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	libvirt "github.com/digitalocean/go-libvirt"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// stepCheckPoolCapacity makes sure every storage pool has enough free space for the volumes
+// of the build before any of them gets created. A pool running out of space in the middle of a build
+// would pause the domain with an I/O error instead of failing the build.
+type stepCheckPoolCapacity struct{}
+
+type plannedPoolUsage struct {
+	capacity   uint64
+	allocation uint64
+	volumes    []string
+}
+
+func (s *stepCheckPoolCapacity) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packersdk.Ui)
+	driver := state.Get("driver").(*libvirt.Libvirt)
+	config := state.Get("config").(*Config)
+
+	if config.SkipPoolCapacityCheck {
+		log.Println("Skipping storage pool capacity check")
+		return multistep.ActionContinue
+	}
+
+	ui.Say("Checking free space of storage pools...")
+
+	usages := map[string]*plannedPoolUsage{}
+	plannedCapacities := make([]uint64, len(config.Volumes))
+	plannedAllocations := make([]uint64, len(config.Volumes))
+
+	for i := range config.Volumes {
+		vol := &config.Volumes[i]
+
+		capacity, allocation, err := vol.PlannedSize(driver)
+
+		// Volumes derived from another volume of this build can only be estimated from that volume's plan
+		for j := 0; j < i && vol.Capacity == ""; j++ {
+			if vol.DependsOn(&config.Volumes[j]) {
+				capacity, allocation, err = plannedCapacities[j], 0, nil
+				if vol.Source.Type == "cloning" || vol.Source.Type == "clone" {
+					allocation = plannedAllocations[j]
+				}
+			}
+		}
+
+		if err != nil {
+			ui.Message(fmt.Sprintf("Couldn't estimate the size of volume %s/%s, leaving it out of the capacity check: %s", vol.Pool, vol.Name, err))
+			continue
+		}
+
+		plannedCapacities[i] = capacity
+		plannedAllocations[i] = allocation
+
+		if capacity == 0 && allocation == 0 {
+			continue
+		}
+
+		usage, ok := usages[vol.Pool]
+		if !ok {
+			usage = &plannedPoolUsage{}
+			usages[vol.Pool] = usage
+		}
+		usage.capacity += capacity
+		usage.allocation += allocation
+		usage.volumes = append(usage.volumes, fmt.Sprintf("%s (capacity %s, allocation %s)", vol.Name, formatBytes(capacity), formatBytes(allocation)))
+	}
+
+	pools := make([]string, 0, len(usages))
+	for pool := range usages {
+		pools = append(pools, pool)
+	}
+	sort.Strings(pools)
+
+	shortages := []string{}
+	for _, poolName := range pools {
+		usage := usages[poolName]
+
+		pool, err := driver.StoragePoolLookupByName(poolName)
+		if err != nil {
+			return haltOnError(ui, state, "Error while looking up storage pool %s: %s", poolName, err)
+		}
+
+		_, _, _, available, err := driver.StoragePoolGetInfo(pool)
+		if err != nil {
+			return haltOnError(ui, state, "Error while getting info of storage pool %s: %s", poolName, err)
+		}
+
+		needed := usage.capacity
+		if config.AllowPoolOvercommit {
+			needed = usage.allocation
+		}
+
+		log.Printf("Storage pool %s: %d bytes needed, %d bytes available\n", poolName, needed, available)
+
+		if needed > available {
+			shortages = append(shortages, fmt.Sprintf(
+				"pool %s: %s needed, only %s available\n    %s",
+				poolName,
+				formatBytes(needed),
+				formatBytes(available),
+				strings.Join(usage.volumes, "\n    "),
+			))
+		}
+	}
+
+	if len(shortages) > 0 {
+		hint := "set allow_pool_overcommit to only require the allocation (size) of thin volumes to fit"
+		if config.AllowPoolOvercommit {
+			hint = "free up some space or move volumes to another pool"
+		}
+		return haltOnError(ui, state, "Not enough free space in storage pools (%s):\n  %s", hint, strings.Join(shortages, "\n  "))
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *stepCheckPoolCapacity) Cleanup(state multistep.StateBag) {
+	// Do nothing
+}
+
+func formatBytes(b uint64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	value := float64(b)
+	i := 0
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f%s", value, units[i])
+}
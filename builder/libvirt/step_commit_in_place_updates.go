@@ -0,0 +1,53 @@
+package libvirt
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	libvirt "github.com/digitalocean/go-libvirt"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/thomasklein94/packer-plugin-libvirt/builder/libvirt/volume"
+)
+
+// stepCommitInPlaceUpdates merges the overlays of volumes updated in place back into the volumes.
+// It runs after a clean shutdown, so the guest has flushed everything into the overlays. Libvirt can only
+// commit the active layer of a running domain, so the domain is started again, paused, for the commit.
+type stepCommitInPlaceUpdates struct{}
+
+func (s *stepCommitInPlaceUpdates) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packersdk.Ui)
+	driver := state.Get("driver").(*libvirt.Libvirt)
+	domain := state.Get("domain").(*libvirt.Domain)
+	updates := state.Get("in_place_updates").([]*volume.PreparationContext)
+
+	if len(updates) == 0 {
+		return multistep.ActionContinue
+	}
+
+	ui.Say("Committing in place updates of volumes...")
+
+	if _, err := driver.DomainCreateWithFlags(*domain, uint32(libvirt.DomainStartPaused)); err != nil {
+		return haltOnError(ui, state, "Couldn't start the domain paused to commit volumes: %s", err)
+	}
+
+	defer func() {
+		if err := driver.DomainDestroy(*domain); err != nil {
+			log.Printf("Couldn't destroy the paused domain: %s\n", err)
+		}
+	}()
+
+	for _, pctx := range updates {
+		ui.Message(fmt.Sprintf("Committing changes into volume %s/%s", pctx.VolumeConfig.Pool, pctx.VolumeConfig.Name))
+		if err := pctx.CommitOverlay(ctx, *domain); err != nil {
+			return haltOnError(ui, state, "Couldn't commit changes into volume %s/%s: %s", pctx.VolumeConfig.Pool, pctx.VolumeConfig.Name, err)
+		}
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *stepCommitInPlaceUpdates) Cleanup(state multistep.StateBag) {
+	// Do nothing
+}
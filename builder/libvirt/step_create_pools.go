@@ -0,0 +1,136 @@
+package libvirt
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	libvirt "github.com/digitalocean/go-libvirt"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"libvirt.org/go/libvirtxml"
+)
+
+// stepCreatePools makes sure every pool listed in `create_pool` exists and is running
+// before any volume is looked up in it.
+type stepCreatePools struct {
+	// Pools defined or started by this step, in the order they were brought up
+	created []createdPool
+}
+
+type createdPool struct {
+	config *CreatePool
+	ref    libvirt.StoragePool
+	// True if the pool was defined by the build, false if an inactive pool was only started
+	defined bool
+}
+
+func (s *stepCreatePools) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packersdk.Ui)
+	driver := state.Get("driver").(*libvirt.Libvirt)
+	config := state.Get("config").(*Config)
+
+	s.created = []createdPool{}
+
+	for i := range config.CreatePools {
+		poolConfig := &config.CreatePools[i]
+
+		if pool, err := driver.StoragePoolLookupByName(poolConfig.Name); err == nil {
+			active, err := driver.StoragePoolIsActive(pool)
+			if err != nil {
+				return haltOnError(ui, state, "Error while checking storage pool %s: %s", poolConfig.Name, err)
+			}
+			if active == 1 {
+				log.Printf("Storage pool %s already exists\n", poolConfig.Name)
+				continue
+			}
+
+			ui.Message(fmt.Sprintf("Starting inactive storage pool %s", poolConfig.Name))
+			if err := driver.StoragePoolCreate(pool, libvirt.StoragePoolCreateWithBuildNoOverwrite); err != nil {
+				return haltOnError(ui, state, "Error while starting storage pool %s: %s", poolConfig.Name, err)
+			}
+			s.created = append(s.created, createdPool{config: poolConfig, ref: pool})
+			continue
+		}
+
+		poolDef := libvirtxml.StoragePool{
+			Type: poolConfig.Type,
+			Name: poolConfig.Name,
+			Target: &libvirtxml.StoragePoolTarget{
+				Path: poolConfig.Path,
+			},
+		}
+
+		poolXml, err := poolDef.Marshal()
+		if err != nil {
+			return haltOnError(ui, state, "Error while creating storage pool definition of %s: %s", poolConfig.Name, err)
+		}
+
+		if state.Get("debug").(bool) {
+			log.Printf("Storage pool definition XML:\n%s\n", poolXml)
+		}
+
+		var pool libvirt.StoragePool
+		if poolConfig.Persistent {
+			ui.Message(fmt.Sprintf("Defining storage pool %s at %s", poolConfig.Name, poolConfig.Path))
+			pool, err = driver.StoragePoolDefineXML(poolXml, 0)
+			if err != nil {
+				return haltOnError(ui, state, "Error while defining storage pool %s: %s", poolConfig.Name, err)
+			}
+			s.created = append(s.created, createdPool{config: poolConfig, ref: pool, defined: true})
+
+			err = driver.StoragePoolCreate(pool, libvirt.StoragePoolCreateWithBuildNoOverwrite)
+		} else {
+			ui.Message(fmt.Sprintf("Creating transient storage pool %s at %s", poolConfig.Name, poolConfig.Path))
+			pool, err = driver.StoragePoolCreateXML(poolXml, libvirt.StoragePoolCreateWithBuildNoOverwrite)
+			if err == nil {
+				s.created = append(s.created, createdPool{config: poolConfig, ref: pool, defined: true})
+			}
+		}
+
+		if err != nil {
+			return haltOnError(ui, state, "Error while starting storage pool %s: %s", poolConfig.Name, err)
+		}
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *stepCreatePools) Cleanup(state multistep.StateBag) {
+	ui := state.Get("ui").(packersdk.Ui)
+	driver := state.Get("driver").(*libvirt.Libvirt)
+
+	artifactPool := ""
+	if artifact, ok := state.GetOk("artifact"); ok {
+		artifactPool = artifact.(*Artifact).volumeRef.Pool
+	}
+
+	// Pools are torn down in the reverse order they were brought up
+	for i := len(s.created) - 1; i >= 0; i-- {
+		created := s.created[i]
+		if !created.config.DestroyOnCleanup {
+			continue
+		}
+
+		if created.ref.Name == artifactPool {
+			ui.Message(fmt.Sprintf("Keeping storage pool %s, it holds the artifact", created.ref.Name))
+			continue
+		}
+
+		ui.Message(fmt.Sprintf("Destroying storage pool %s", created.ref.Name))
+
+		if active, err := driver.StoragePoolIsActive(created.ref); err == nil && active == 1 {
+			if err := driver.StoragePoolDestroy(created.ref); err != nil {
+				ui.Error(fmt.Sprintf("Couldn't stop storage pool %s: %s", created.ref.Name, err))
+				continue
+			}
+		}
+
+		// Only pools defined by the build are removed, a pool which existed before is only stopped again
+		if created.defined && created.config.Persistent {
+			if err := driver.StoragePoolUndefine(created.ref); err != nil {
+				ui.Error(fmt.Sprintf("Couldn't undefine storage pool %s: %s", created.ref.Name, err))
+			}
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package libvirt
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	libvirt "github.com/digitalocean/go-libvirt"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	libvirtutils "github.com/thomasklein94/packer-plugin-libvirt/libvirt-utils"
+)
+
+// stepCreatePxeNetwork creates the transient network the domain boots from over the network.
+// libvirt's dnsmasq hands out the addresses, the boot file and serves the TFTP root.
+type stepCreatePxeNetwork struct {
+	network *libvirt.Network
+}
+
+func (s *stepCreatePxeNetwork) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+
+	if config.PxeNetwork == nil {
+		return multistep.ActionContinue
+	}
+
+	ui := state.Get("ui").(packersdk.Ui)
+	driver := state.Get("driver").(*libvirt.Libvirt)
+	pxe := config.PxeNetwork
+
+	if pxe.HttpBootFile != "" && pxe.HttpHost == "" {
+		uri := libvirtutils.LibvirtUri{}
+		if uri.Unmarshal(config.LibvirtURI) != nil || !uri.IsLocal() {
+			return haltOnError(ui, state, "Packer doesn't run on the libvirt host, set the http_host of pxe_network to an address the domain can reach Packer on")
+		}
+	}
+
+	if _, err := driver.NetworkLookupByName(pxe.Name); err == nil {
+		return haltOnError(ui, state, "A network named %s already exists, set the name of pxe_network to an unused name", pxe.Name)
+	}
+
+	httpPort := 0
+	if port, ok := state.GetOk("http_port"); ok {
+		httpPort = port.(int)
+	}
+
+	networkDef := pxe.NetworkDefinition(httpPort)
+	networkXml, err := networkDef.Marshal()
+	if err != nil {
+		return haltOnError(ui, state, "Error while creating the definition of network %s: %s", pxe.Name, err)
+	}
+
+	if config.PackerDebug {
+		log.Printf("PXE network definition XML:\n%s\n", networkXml)
+	}
+
+	ui.Say(fmt.Sprintf("Creating transient network %s for network boot", pxe.Name))
+
+	network, err := driver.NetworkCreateXML(networkXml)
+	if err != nil {
+		return haltOnError(ui, state, "Error while creating network %s: %s", pxe.Name, err)
+	}
+	s.network = &network
+
+	return multistep.ActionContinue
+}
+
+func (s *stepCreatePxeNetwork) Cleanup(state multistep.StateBag) {
+	if s.network == nil {
+		return
+	}
+
+	ui := state.Get("ui").(packersdk.Ui)
+	driver := state.Get("driver").(*libvirt.Libvirt)
+
+	ui.Say(fmt.Sprintf("Destroying network %s", s.network.Name))
+	if err := driver.NetworkDestroy(*s.network); err != nil {
+		ui.Error(fmt.Sprintf("Couldn't destroy network %s: %s", s.network.Name, err))
+	}
+	s.network = nil
+}
@@ -2,6 +2,7 @@ package libvirt
 
 import (
 	"context"
+	"fmt"
 	"log"
 
 	libvirt "github.com/digitalocean/go-libvirt"
@@ -18,6 +19,14 @@ func (s *stepDefineDomain) Run(ctx context.Context, state multistep.StateBag) mu
 	driver := state.Get("driver").(*libvirt.Libvirt)
 	domainDef := state.Get("domain_def").(*libvirtxml.Domain)
 
+	if config.DirectKernelBoot.Cmdline != "" {
+		cmdline, err := renderBootTemplate(config, state, config.DirectKernelBoot.Cmdline)
+		if err != nil {
+			return haltOnError(ui, state, "Error while rendering the kernel command line: %s", err)
+		}
+		domainDef.OS.Cmdline = cmdline
+	}
+
 	ui.Say("Sending the domain definition to libvirt")
 
 	xmldesc, err := domainDef.Marshal()
@@ -30,10 +39,19 @@ func (s *stepDefineDomain) Run(ctx context.Context, state multistep.StateBag) mu
 		log.Printf("domain definition XML:\n%s\n", xmldesc)
 	}
 
-	domain, err := driver.DomainDefineXML(xmldesc)
+	var domain libvirt.Domain
 
-	if err != nil {
-		return haltOnError(ui, state, "DefineDomain.RPC: %s", err)
+	if replaced, ok := state.GetOk("domain_to_replace"); ok {
+		domain, err = replaceDomain(ui, driver, config, *replaced.(*libvirt.Domain), xmldesc)
+		if err != nil {
+			return haltOnError(ui, state, "Couldn't replace the existing domain %s: %s", config.DomainName, err)
+		}
+		state.Remove("domain_to_replace")
+	} else {
+		domain, err = driver.DomainDefineXML(xmldesc)
+		if err != nil {
+			return haltOnError(ui, state, "DefineDomain.RPC: %s", err)
+		}
 	}
 
 	state.Put("domain", &domain)
@@ -64,6 +82,7 @@ func (s *stepDefineDomain) Run(ctx context.Context, state multistep.StateBag) mu
 }
 
 func (s *stepDefineDomain) Cleanup(state multistep.StateBag) {
+	config := state.Get("config").(*Config)
 	ui := state.Get("ui").(packersdk.Ui)
 	domain, ok := state.GetOk("domain")
 	driver := state.Get("driver").(*libvirt.Libvirt)
@@ -71,8 +90,66 @@ func (s *stepDefineDomain) Cleanup(state multistep.StateBag) {
 	if ok && domain != nil {
 		ui.Say("Undefining the domain...")
 		domain := domain.(*libvirt.Domain)
-		driver.DomainUndefineFlags(*domain, 0)
+		// UEFI domains can't be undefined without deciding about their NVRAM,
+		// which is only kept if the user gave it with nvram_path
+		flags := libvirt.DomainUndefineNvram
+		if config.NvramPath != "" {
+			flags = libvirt.DomainUndefineKeepNvram
+		}
+		driver.DomainUndefineFlags(*domain, flags)
 	}
 
 	state.Remove("domain")
 }
+
+// replaceDomain undefines the existing domain and defines the new one in its place.
+// If the new definition is rejected, the existing domain is defined again, so nothing is lost.
+// Its NVRAM is only removed once the new domain is defined, so the new domain doesn't inherit it
+// when libvirt gives both domains the same NVRAM file.
+func replaceDomain(ui packersdk.Ui, driver *libvirt.Libvirt, config *Config, existing libvirt.Domain, xmldesc string) (libvirt.Domain, error) {
+	existingXml, err := driver.DomainGetXMLDesc(existing, libvirt.DomainXMLSecure|libvirt.DomainXMLInactive)
+	if err != nil {
+		return libvirt.Domain{}, fmt.Errorf("couldn't save its definition: %s", err)
+	}
+
+	existingDef := &libvirtxml.Domain{}
+	if err := existingDef.Unmarshal(existingXml); err != nil {
+		return libvirt.Domain{}, fmt.Errorf("couldn't save its definition: %s", err)
+	}
+
+	ui.Message(fmt.Sprintf("Undefining the existing domain %s", existing.Name))
+	flags := libvirt.DomainUndefineManagedSave | libvirt.DomainUndefineSnapshotsMetadata | libvirt.DomainUndefineCheckpointsMetadata | libvirt.DomainUndefineKeepNvram
+	if err := driver.DomainUndefineFlags(existing, flags); err != nil {
+		return libvirt.Domain{}, err
+	}
+
+	domain, err := driver.DomainDefineXML(xmldesc)
+	if err != nil {
+		if _, restoreErr := driver.DomainDefineXML(existingXml); restoreErr != nil {
+			return libvirt.Domain{}, fmt.Errorf("%s, and the existing domain couldn't be restored: %s", err, restoreErr)
+		}
+		ui.Message(fmt.Sprintf("Restored the existing domain %s", existing.Name))
+		return libvirt.Domain{}, err
+	}
+
+	// An NVRAM file given with nvram_path belongs to the user
+	if config.NvramPath != "" || existingDef.OS == nil || existingDef.OS.NVRam == nil {
+		return domain, nil
+	}
+
+	newXml, err := driver.DomainGetXMLDesc(domain, libvirt.DomainXMLInactive)
+	if err != nil {
+		return domain, nil
+	}
+	newDef := &libvirtxml.Domain{}
+	if newDef.Unmarshal(newXml) != nil || newDef.OS == nil || newDef.OS.NVRam == nil || newDef.OS.NVRam.NVRam != existingDef.OS.NVRam.NVRam {
+		return domain, nil
+	}
+
+	// Removing the NVRAM of the existing domain is only possible by undefining a domain using it
+	if err := driver.DomainUndefineFlags(domain, libvirt.DomainUndefineNvram); err != nil {
+		return libvirt.Domain{}, fmt.Errorf("couldn't remove the NVRAM of the existing domain: %s", err)
+	}
+
+	return driver.DomainDefineXML(xmldesc)
+}
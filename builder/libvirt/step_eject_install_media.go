@@ -0,0 +1,151 @@
+package libvirt
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	libvirt "github.com/digitalocean/go-libvirt"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	libvirtutils "github.com/thomasklein94/packer-plugin-libvirt/libvirt-utils"
+	"libvirt.org/go/libvirtxml"
+)
+
+// stepEjectInstallMedia waits for the installer to reboot the domain, then ejects or detaches the install media
+// listed in `eject_on_reboot` and starts the domain again, booting from the disk.
+// The domain is defined with on_reboot=destroy, so the reboot stops it and the new boot order takes effect.
+type stepEjectInstallMedia struct{}
+
+func (s *stepEjectInstallMedia) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+
+	if len(config.EjectOnReboot) == 0 {
+		return multistep.ActionContinue
+	}
+
+	ui := state.Get("ui").(packersdk.Ui)
+	driver := state.Get("driver").(*libvirt.Libvirt)
+	domain := state.Get("domain").(*libvirt.Domain)
+
+	ui.Say("Waiting for the installer to reboot the domain...")
+
+	if err := waitForDomainToStop(ctx, driver, *domain); err != nil {
+		return haltOnError(ui, state, "Error while waiting for the installer to reboot the domain: %s", err)
+	}
+
+	rawDef, err := driver.DomainGetXMLDesc(*domain, libvirt.DomainXMLInactive|libvirt.DomainXMLSecure)
+	if err != nil {
+		return haltOnError(ui, state, "Error while getting the domain definition: %s", err)
+	}
+
+	domainDef := &libvirtxml.Domain{}
+	if err := domainDef.Unmarshal(rawDef); err != nil {
+		return haltOnError(ui, state, "Error while parsing the domain definition: %s", err)
+	}
+
+	ejectInstallMedia(ui, domainDef, config.EjectOnReboot)
+
+	// A directly booted installer kernel would start the installer again just like the install media
+	if domainDef.OS != nil {
+		domainDef.OS.Kernel = ""
+		domainDef.OS.Initrd = ""
+		domainDef.OS.Cmdline = ""
+		domainDef.OS.DTB = ""
+	}
+
+	// Later reboots, like the ones of provisioners, restart the domain again
+	domainDef.OnReboot = ""
+
+	xmldesc, err := domainDef.Marshal()
+	if err != nil {
+		return haltOnError(ui, state, "Error while creating the domain definition: %s", err)
+	}
+
+	if config.PackerDebug {
+		log.Printf("domain definition XML after ejecting the install media:\n%s\n", xmldesc)
+	}
+
+	if _, err := driver.DomainDefineXML(xmldesc); err != nil {
+		return haltOnError(ui, state, "Error while redefining the domain: %s", err)
+	}
+	state.Put("domain_def", domainDef)
+
+	ui.Say("Starting the domain from its disk")
+	if err := driver.DomainCreate(*domain); err != nil {
+		return haltOnError(ui, state, "DomainCreate.RPC: %s", err)
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *stepEjectInstallMedia) Cleanup(state multistep.StateBag) {
+	// Do nothing
+}
+
+// ejectInstallMedia empties the cdrom and floppy drives with the given aliases and detaches every other disk
+// with those aliases, then makes sure the domain doesn't boot from them anymore.
+func ejectInstallMedia(ui packersdk.Ui, domainDef *libvirtxml.Domain, aliases []string) {
+	disks := []libvirtxml.DomainDisk{}
+
+	for _, disk := range domainDef.Devices.Disks {
+		if disk.Alias == nil || !libvirtutils.ContainsString(aliases, disk.Alias.Name) {
+			disks = append(disks, disk)
+			continue
+		}
+
+		if disk.Device == "cdrom" || disk.Device == "floppy" {
+			ui.Message(fmt.Sprintf("Ejecting the media of %s", disk.Alias.Name))
+			disk.Source = nil
+			disk.Driver = nil
+			disk.Boot = nil
+			disks = append(disks, disk)
+		} else {
+			ui.Message(fmt.Sprintf("Detaching %s", disk.Alias.Name))
+		}
+	}
+
+	domainDef.Devices.Disks = disks
+
+	if domainDef.OS == nil {
+		return
+	}
+
+	bootDevices := []libvirtxml.DomainBootDevice{}
+	for _, bd := range domainDef.OS.BootDevices {
+		if bd.Dev != "cdrom" && bd.Dev != "fd" {
+			bootDevices = append(bootDevices, bd)
+		}
+	}
+	if len(bootDevices) == 0 && len(domainDef.OS.BootDevices) > 0 {
+		bootDevices = append(bootDevices, libvirtxml.DomainBootDevice{Dev: "hd"})
+	}
+	domainDef.OS.BootDevices = bootDevices
+}
+
+func waitForDomainToStop(ctx context.Context, driver *libvirt.Libvirt, domain libvirt.Domain) error {
+	subCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pollErrs := make(chan error, 1)
+	pollResults := make(chan libvirt.DomainState)
+
+	go libvirtutils.PollDomainState(subCtx, 5*time.Second, driver, domain, pollResults, pollErrs)
+
+	for {
+		select {
+		case res := <-pollResults:
+			if res == libvirt.DomainCrashed {
+				return fmt.Errorf("domain crashed")
+			}
+			if libvirtutils.DomainStateMeansStopped(res) {
+				return nil
+			}
+		case err := <-pollErrs:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package libvirt
+
+import (
+	"fmt"
+	"testing"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"libvirt.org/go/libvirtxml"
+)
+
+func TestEjectInstallMedia(t *testing.T) {
+	disk := func(alias string, device string, bootOrder uint) libvirtxml.DomainDisk {
+		d := libvirtxml.DomainDisk{
+			Device: device,
+			Alias:  &libvirtxml.DomainAlias{Name: alias},
+			Source: &libvirtxml.DomainDiskSource{File: &libvirtxml.DomainDiskSourceFile{File: "/var/lib/libvirt/images/" + alias}},
+			Driver: &libvirtxml.DomainDiskDriver{Name: "qemu", Type: "raw"},
+		}
+		if bootOrder > 0 {
+			d.Boot = &libvirtxml.DomainDeviceBoot{Order: bootOrder}
+		}
+		return d
+	}
+
+	tests := []struct {
+		name         string
+		disks        []libvirtxml.DomainDisk
+		bootDevices  []string
+		aliases      []string
+		expectedBoot []string
+		// the remaining disks by alias, with whether they still have a source and a boot order
+		expectedDisks map[string][2]bool
+	}{
+		{
+			name:          "cdrom only boot falls back to hd",
+			disks:         []libvirtxml.DomainDisk{disk("ua-artifact", "disk", 0), disk("ua-installer", "cdrom", 0)},
+			bootDevices:   []string{"cdrom"},
+			aliases:       []string{"ua-installer"},
+			expectedBoot:  []string{"hd"},
+			expectedDisks: map[string][2]bool{"ua-artifact": {true, false}, "ua-installer": {false, false}},
+		},
+		{
+			name:          "cdrom and floppy are removed from the boot devices",
+			disks:         []libvirtxml.DomainDisk{disk("ua-artifact", "disk", 0), disk("ua-installer", "cdrom", 0)},
+			bootDevices:   []string{"fd", "cdrom", "network", "hd"},
+			aliases:       []string{"ua-installer"},
+			expectedBoot:  []string{"network", "hd"},
+			expectedDisks: map[string][2]bool{"ua-artifact": {true, false}, "ua-installer": {false, false}},
+		},
+		{
+			name:          "per-device boot order is dropped on ejected media",
+			disks:         []libvirtxml.DomainDisk{disk("ua-artifact", "disk", 2), disk("ua-installer", "cdrom", 1), disk("ua-drivers", "floppy", 3)},
+			aliases:       []string{"ua-installer", "ua-drivers"},
+			expectedBoot:  []string{},
+			expectedDisks: map[string][2]bool{"ua-artifact": {true, true}, "ua-installer": {false, false}, "ua-drivers": {false, false}},
+		},
+		{
+			name:          "other volumes are detached",
+			disks:         []libvirtxml.DomainDisk{disk("ua-artifact", "disk", 0), disk("ua-installer", "disk", 0), disk("ua-seed", "cdrom", 0)},
+			bootDevices:   []string{"hd"},
+			aliases:       []string{"ua-installer"},
+			expectedBoot:  []string{"hd"},
+			expectedDisks: map[string][2]bool{"ua-artifact": {true, false}, "ua-seed": {true, false}},
+		},
+	}
+
+	for _, tt := range tests {
+		domainDef := &libvirtxml.Domain{
+			OS:      &libvirtxml.DomainOS{},
+			Devices: &libvirtxml.DomainDeviceList{Disks: tt.disks},
+		}
+		for _, dev := range tt.bootDevices {
+			domainDef.OS.BootDevices = append(domainDef.OS.BootDevices, libvirtxml.DomainBootDevice{Dev: dev})
+		}
+
+		ejectInstallMedia(packersdk.TestUi(t), domainDef, tt.aliases)
+
+		bootDevices := []string{}
+		for _, bd := range domainDef.OS.BootDevices {
+			bootDevices = append(bootDevices, bd.Dev)
+		}
+		if fmt.Sprint(bootDevices) != fmt.Sprint(tt.expectedBoot) {
+			t.Errorf("%s: expected boot devices %v, got %v", tt.name, tt.expectedBoot, bootDevices)
+		}
+
+		disks := map[string][2]bool{}
+		for _, d := range domainDef.Devices.Disks {
+			disks[d.Alias.Name] = [2]bool{d.Source != nil, d.Boot != nil}
+		}
+		if fmt.Sprint(disks) != fmt.Sprint(tt.expectedDisks) {
+			t.Errorf("%s: expected disks %v, got %v", tt.name, tt.expectedDisks, disks)
+		}
+	}
+}
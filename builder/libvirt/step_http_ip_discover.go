@@ -0,0 +1,107 @@
+package libvirt
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+
+	libvirt "github.com/digitalocean/go-libvirt"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	libvirtutils "github.com/thomasklein94/packer-plugin-libvirt/libvirt-utils"
+	"libvirt.org/go/libvirtxml"
+)
+
+// stepHTTPIPDiscover finds the address the domain reaches Packer's HTTP server on and puts it into the state bag
+// as `http_ip`, for the boot command and the kernel command line.
+type stepHTTPIPDiscover struct{}
+
+func (s *stepHTTPIPDiscover) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packersdk.Ui)
+	driver := state.Get("driver").(*libvirt.Libvirt)
+	config := state.Get("config").(*Config)
+
+	ip, err := discoverHTTPIP(driver, config)
+	if err != nil {
+		// Only templates referring to {{ .HTTPIP }} need it
+		if len(config.BootConfig.BootCommand) > 0 || config.DirectKernelBoot.Cmdline != "" {
+			ui.Message(fmt.Sprintf("Couldn't find the address of the HTTP server for the domain, {{ .HTTPIP }} is empty: %s", err))
+		}
+		log.Printf("Couldn't discover the HTTP IP: %s\n", err)
+	}
+
+	state.Put("http_ip", ip)
+
+	return multistep.ActionContinue
+}
+
+func (s *stepHTTPIPDiscover) Cleanup(state multistep.StateBag) {
+	// Do nothing
+}
+
+// discoverHTTPIP prefers an explicit bind address, then the address of the PXE network,
+// then the host's address on the first libvirt network the domain is attached to.
+func discoverHTTPIP(driver *libvirt.Libvirt, config *Config) (string, error) {
+	if config.HTTPConfig.HTTPAddress != "" && config.HTTPConfig.HTTPAddress != "0.0.0.0" {
+		return config.HTTPConfig.HTTPAddress, nil
+	}
+
+	if config.PxeNetwork != nil && config.PxeNetwork.HttpHost != "" {
+		return config.PxeNetwork.HttpHost, nil
+	}
+
+	uri := libvirtutils.LibvirtUri{}
+	if uri.Unmarshal(config.LibvirtURI) != nil || !uri.IsLocal() {
+		return "", fmt.Errorf("Packer doesn't run on the libvirt host, set http_bind_address to an address the domain can reach Packer on")
+	}
+
+	if config.PxeNetwork != nil {
+		return config.PxeNetwork.hostIP.String(), nil
+	}
+
+	for _, ni := range config.NetworkInterfaces {
+		if ni.Type != "managed" && ni.Type != "network" {
+			continue
+		}
+
+		network, err := driver.NetworkLookupByName(ni.Managed.Network)
+		if err != nil {
+			return "", fmt.Errorf("error while looking up network %s: %s", ni.Managed.Network, err)
+		}
+
+		rawNetworkDef, err := driver.NetworkGetXMLDesc(network, 0)
+		if err != nil {
+			return "", fmt.Errorf("error while getting the definition of network %s: %s", ni.Managed.Network, err)
+		}
+
+		networkDef := &libvirtxml.Network{}
+		if err = networkDef.Unmarshal(rawNetworkDef); err != nil {
+			return "", fmt.Errorf("error while reading the definition of network %s: %s", ni.Managed.Network, err)
+		}
+
+		if ip := networkHostIP(networkDef); ip != "" {
+			return ip, nil
+		}
+	}
+
+	return "", fmt.Errorf("no libvirt network with an address of the host is attached, set http_bind_address")
+}
+
+// networkHostIP returns the address of the host on a libvirt network, preferring IPv4
+func networkHostIP(networkDef *libvirtxml.Network) string {
+	fallback := ""
+	for _, ip := range networkDef.IPs {
+		parsed := net.ParseIP(ip.Address)
+		if parsed == nil {
+			continue
+		}
+		if parsed.To4() != nil {
+			return ip.Address
+		}
+		if fallback == "" {
+			fallback = ip.Address
+		}
+	}
+	return fallback
+}
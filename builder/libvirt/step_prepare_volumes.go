@@ -4,11 +4,13 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"sync"
 
 	libvirt "github.com/digitalocean/go-libvirt"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/thomasklein94/packer-plugin-libvirt/builder/libvirt/volume"
+	libvirtutils "github.com/thomasklein94/packer-plugin-libvirt/libvirt-utils"
 	"libvirt.org/go/libvirtxml"
 )
 
@@ -26,64 +28,216 @@ func (s *stepPrepareVolumes) Run(ctx context.Context, state multistep.StateBag)
 
 	ui.Say("Preparing volumes...")
 
-	for _, volumeConfig := range config.Volumes {
+	uri := libvirtutils.LibvirtUri{}
+	localConnection := uri.Unmarshal(config.LibvirtURI) == nil && uri.IsLocal()
+
+	var remoteShell libvirtutils.RemoteShell
+	if shell, ok := state.GetOk("remote_shell"); ok {
+		remoteShell = shell.(libvirtutils.RemoteShell)
+	}
+
+	for i := range config.Volumes {
+		volumeConfig := &config.Volumes[i]
 		pctx := &volume.PreparationContext{
 			State:            state,
 			Ui:               ui,
 			Driver:           driver,
-			VolumeConfig:     nil,
+			VolumeConfig:     volumeConfig,
 			VolumeRef:        nil,
 			VolumeDefinition: nil,
 			PoolRef:          nil,
 			VolumeIsCreated:  false,
 			VolumeIsArtifact: volumeConfig.Alias == config.ArtifactVolumeAlias,
 			Context:          ctx,
+			LocalConnection:  localConnection,
+			RemoteShell:      remoteShell,
 		}
 
 		s.preparations = append(s.preparations, pctx)
-		if action := volumeConfig.PrepareVolume(pctx); action != multistep.ActionContinue {
-			return action
+	}
+
+	// Every volume is checked against its pool before any of them is created
+	errs := &packersdk.MultiError{}
+	for _, pctx := range s.preparations {
+		if pctx.VolumeConfig.ValidateAgainstPool(pctx) != multistep.ActionContinue {
+			errs = packersdk.MultiErrorAppend(errs, pctx.Error)
 		}
+	}
+
+	if len(errs.Errors) > 0 {
+		state.Put("error", errs)
+		return multistep.ActionHalt
+	}
+
+	errs = s.prepareConcurrently(config.VolumeParallelism)
+
+	if len(errs.Errors) > 0 {
+		state.Put("error", errs)
+		return multistep.ActionHalt
+	}
 
-		domainDisk := volumeConfig.DomainDiskXml()
+	inPlaceUpdates := []*volume.PreparationContext{}
+
+	// Disks are attached in the order of declaration, regardless of the order their preparation finished
+	for _, pctx := range s.preparations {
+		domainDisk := pctx.DomainDiskXml()
 		if domainDisk != nil {
 			domainDef.Devices.Disks = append(domainDef.Devices.Disks, *domainDisk)
 		}
-
+		if pctx.OverlayRef != nil {
+			inPlaceUpdates = append(inPlaceUpdates, pctx)
+		}
+		if pctx.VolumeConfig.BootFile() != "" {
+			path, err := pctx.BootFilePath()
+			if err != nil {
+				return haltOnError(ui, state, "%s", err)
+			}
+			switch pctx.VolumeConfig.BootFile() {
+			case volume.BootFileKernel:
+				domainDef.OS.Kernel = path
+			case volume.BootFileInitrd:
+				domainDef.OS.Initrd = path
+			case volume.BootFileDtb:
+				domainDef.OS.DTB = path
+			}
+		}
 	}
 
+	state.Put("in_place_updates", inPlaceUpdates)
+
 	return multistep.ActionContinue
 }
 
+// prepareConcurrently prepares every volume with at most `parallelism` preparations running at the same time.
+// A volume waits for every volume it depends on. Once a preparation fails, no new preparation is started,
+// but the ones already running are allowed to finish, so every created volume is known for the cleanup.
+func (s *stepPrepareVolumes) prepareConcurrently(parallelism int) *packersdk.MultiError {
+	if parallelism <= 0 {
+		parallelism = 1
+	}
+
+	var wg sync.WaitGroup
+	var failedMu sync.Mutex
+	failed := false
+
+	semaphore := make(chan struct{}, parallelism)
+	done := make([]chan struct{}, len(s.preparations))
+	skipped := make([]bool, len(s.preparations))
+
+	for i := range s.preparations {
+		done[i] = make(chan struct{})
+	}
+
+	for i, pctx := range s.preparations {
+		dependencies := []int{}
+		for j := 0; j < i; j++ {
+			if pctx.VolumeConfig.DependsOn(s.preparations[j].VolumeConfig) {
+				dependencies = append(dependencies, j)
+			}
+		}
+
+		wg.Add(1)
+		go func(i int, pctx *volume.PreparationContext, dependencies []int) {
+			defer wg.Done()
+			defer close(done[i])
+
+			for _, j := range dependencies {
+				<-done[j]
+			}
+
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			failedMu.Lock()
+			skip := failed
+			failedMu.Unlock()
+
+			if skip || pctx.Context.Err() != nil {
+				log.Printf("Skipping preparation of volume %s/%s\n", pctx.VolumeConfig.Pool, pctx.VolumeConfig.Name)
+				skipped[i] = true
+				return
+			}
+
+			action := pctx.VolumeConfig.PrepareVolume(pctx)
+
+			if action != multistep.ActionContinue {
+				if pctx.Error == nil {
+					pctx.Error = fmt.Errorf("preparation of volume %s/%s was interrupted", pctx.VolumeConfig.Pool, pctx.VolumeConfig.Name)
+				}
+				failedMu.Lock()
+				failed = true
+				failedMu.Unlock()
+			}
+		}(i, pctx, dependencies)
+	}
+
+	wg.Wait()
+
+	errs := &packersdk.MultiError{}
+	for i, pctx := range s.preparations {
+		if pctx.Error != nil {
+			errs = packersdk.MultiErrorAppend(errs, pctx.Error)
+		} else if skipped[i] && pctx.Context.Err() != nil {
+			errs = packersdk.MultiErrorAppend(errs, pctx.Context.Err())
+			break
+		}
+	}
+
+	return errs
+}
+
 func (s *stepPrepareVolumes) Cleanup(state multistep.StateBag) {
 	ui := state.Get("ui").(packersdk.Ui)
 	ui.Say("Cleaning up volumes...")
 
 	for _, pctx := range s.preparations {
 		log.Printf("Checking volume %s/%s for cleanup\n", pctx.VolumeConfig.Pool, pctx.VolumeConfig.Name)
-		if pctx.VolumeRef != nil && pctx.VolumeIsCreated {
-			abort, abortSet := state.GetOk("aborted")
-			_, canceled := state.GetOk(multistep.StateCancelled)
-			_, halted := state.GetOk(multistep.StateHalted)
-
-			delete := !pctx.VolumeIsArtifact || (abortSet && abort.(bool)) || canceled || halted
-
-			if delete {
-				pctx.Ui.Message(fmt.Sprintf("Cleaning up volume %s/%s", pctx.VolumeRef.Pool, pctx.VolumeRef.Name))
-				err := pctx.Driver.StorageVolDelete(*pctx.VolumeRef, libvirt.StorageVolDeleteNormal)
-				if err != nil {
-					pctx.Ui.Error(fmt.Sprintf("Couldn't clean up volume %s/%s: %s", pctx.VolumeConfig.Pool, pctx.VolumeConfig.Name, err))
-				}
-			} else {
-				if pctx.VolumeIsArtifact {
-					pctx.RefreshVolumeDefinition()
-					state.Put("artifact", &Artifact{
-						volumeDef: *pctx.VolumeDefinition,
-						volumeRef: *pctx.VolumeRef,
-						driver:    pctx.Driver,
-					})
-				}
+
+		if pctx.OverlayRef != nil {
+			if !pctx.OverlayIsCommitted {
+				pctx.Ui.Message(fmt.Sprintf("Rolling back the changes of volume %s/%s", pctx.VolumeConfig.Pool, pctx.VolumeConfig.Name))
 			}
+			if err := pctx.DiscardOverlay(); err != nil {
+				pctx.Ui.Error(fmt.Sprintf("Couldn't delete the overlay of volume %s/%s: %s", pctx.VolumeConfig.Pool, pctx.VolumeConfig.Name, err))
+			}
+		}
+
+		if pctx.VolumeRef == nil || !(pctx.VolumeIsCreated || pctx.VolumeIsReused) {
+			continue
+		}
+
+		abort, abortSet := state.GetOk("aborted")
+		_, canceled := state.GetOk(multistep.StateCancelled)
+		_, halted := state.GetOk(multistep.StateHalted)
+
+		failed := (abortSet && abort.(bool)) || canceled || halted
+		failed = failed || (pctx.VolumeConfig.UpdateInPlace && !pctx.OverlayIsCommitted)
+
+		// Reused volumes existed before the build, so they're never deleted
+		delete := pctx.VolumeIsCreated && (!pctx.VolumeIsArtifact || failed)
+
+		if delete {
+			pctx.Ui.Message(fmt.Sprintf("Cleaning up volume %s/%s", pctx.VolumeRef.Pool, pctx.VolumeRef.Name))
+			err := pctx.Driver.StorageVolDelete(*pctx.VolumeRef, libvirt.StorageVolDeleteNormal)
+			if err != nil {
+				pctx.Ui.Error(fmt.Sprintf("Couldn't clean up volume %s/%s: %s", pctx.VolumeConfig.Pool, pctx.VolumeConfig.Name, err))
+			}
+		} else if pctx.VolumeIsArtifact && !failed {
+			pctx.RefreshVolumeDefinition()
+			state.Put("artifact", &Artifact{
+				volumeDef:            *pctx.VolumeDefinition,
+				volumeRef:            *pctx.VolumeRef,
+				driver:               pctx.Driver,
+				reused:               pctx.VolumeIsReused,
+				encryptionSecretUUID: pctx.EncryptionSecretUUID(),
+			})
+		}
+	}
+
+	// Secrets go last, the domain and the volumes using them are gone by now
+	for _, pctx := range s.preparations {
+		if err := pctx.UndefineEncryptionSecret(); err != nil {
+			ui.Error(fmt.Sprintf("Couldn't remove the encryption secret of volume %s/%s: %s", pctx.VolumeConfig.Pool, pctx.VolumeConfig.Name, err))
 		}
 	}
 }
@@ -0,0 +1,81 @@
+package libvirt
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	libvirt "github.com/digitalocean/go-libvirt"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/thomasklein94/packer-plugin-libvirt/builder/libvirt/volume"
+	libvirtutils "github.com/thomasklein94/packer-plugin-libvirt/libvirt-utils"
+	"libvirt.org/go/libvirtxml"
+)
+
+// stepResolveDomainConflict applies `domain_on_conflict` when a domain with the build's name already exists.
+// A domain to be replaced is only undefined right before the new definition is sent to libvirt.
+type stepResolveDomainConflict struct{}
+
+// maxDomainRenameAttempts limits the search for a free name with domain_on_conflict = rename
+const maxDomainRenameAttempts = 100
+
+func (s *stepResolveDomainConflict) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packersdk.Ui)
+	driver := state.Get("driver").(*libvirt.Libvirt)
+	config := state.Get("config").(*Config)
+	domainDef := state.Get("domain_def").(*libvirtxml.Domain)
+
+	existing, err := driver.DomainLookupByName(config.DomainName)
+	if err != nil {
+		log.Printf("No domain named %s exists yet\n", config.DomainName)
+		return multistep.ActionContinue
+	}
+
+	switch config.DomainOnConflict {
+	case volume.ConflictReplace:
+		domainState, _, err := driver.DomainGetState(existing, 0)
+		if err != nil {
+			return haltOnError(ui, state, "Error while getting the state of domain %s: %s", config.DomainName, err)
+		}
+		if !libvirtutils.DomainStateMeansStopped(libvirt.DomainState(domainState)) {
+			return haltOnError(ui, state, "Domain %s can't be replaced while it's running", config.DomainName)
+		}
+		ui.Message(fmt.Sprintf("Domain %s already exists, it will be replaced", config.DomainName))
+		state.Put("domain_to_replace", &existing)
+
+	case volume.ConflictRename:
+		name, err := freeDomainName(driver, config.DomainName)
+		if err != nil {
+			return haltOnError(ui, state, "Domain %s already exists and couldn't be renamed: %s", config.DomainName, err)
+		}
+		ui.Message(fmt.Sprintf("Domain %s already exists, using the name '%s' instead", config.DomainName, name))
+		config.DomainName = name
+		domainDef.Name = name
+
+		// Generated volume names still carry the old domain name, they'd collide with the volumes of the existing domain
+		for i := range config.Volumes {
+			config.Volumes[i].RenameDomain(name)
+		}
+
+	default:
+		return haltOnError(ui, state, "Domain %s already exists. Set domain_on_conflict to replace or rename to build anyway", config.DomainName)
+	}
+
+	return multistep.ActionContinue
+}
+
+// freeDomainName finds the first name of the form <name>-<n> no domain uses yet
+func freeDomainName(driver *libvirt.Libvirt, name string) (string, error) {
+	for i := 1; i <= maxDomainRenameAttempts; i++ {
+		candidate := fmt.Sprintf("%s-%d", name, i)
+		if _, err := driver.DomainLookupByName(candidate); err != nil {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("%s-1 to %s-%d are all taken", name, name, maxDomainRenameAttempts)
+}
+
+func (s *stepResolveDomainConflict) Cleanup(state multistep.StateBag) {
+	// Do nothing
+}
@@ -42,7 +42,7 @@ func (s *stepShutdownDomain) Run(ctx context.Context, state multistep.StateBag)
 	timeout := time.After(config.ShutdownTimeout)
 	period := 5 * time.Second
 
-	go libvirtutils.PollDomainState(subCtx, period, *driver, *domain, pollResults, pollErrs)
+	go libvirtutils.PollDomainState(subCtx, period, driver, *domain, pollResults, pollErrs)
 
 	for {
 		select {
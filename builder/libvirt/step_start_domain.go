@@ -66,7 +66,7 @@ func (s *stepStartDomain) Cleanup(state multistep.StateBag) {
 		timeout := time.After(config.ShutdownTimeout)
 		period := 5 * time.Second
 
-		go libvirtutils.PollDomainState(subCtx, period, *driver, *domain, pollResults, pollErrs)
+		go libvirtutils.PollDomainState(subCtx, period, driver, *domain, pollResults, pollErrs)
 
 	checks:
 		for {
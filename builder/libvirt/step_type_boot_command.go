@@ -40,7 +40,11 @@ func (s *stepTypeBootCommand) Run(ctx context.Context, state multistep.StateBag)
 		return nil
 	}
 
-	flatBootCommand := strings.Join(config.BootConfig.BootCommand, "")
+	flatBootCommand, err := renderBootTemplate(config, state, strings.Join(config.BootConfig.BootCommand, ""))
+	if err != nil {
+		return haltOnError(ui, state, "Error while rendering the boot command: %s", err)
+	}
+
 	seq, err := bootcommand.GenerateExpressionSequence(flatBootCommand)
 
 	if err != nil {
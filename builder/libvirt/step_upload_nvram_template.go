@@ -0,0 +1,103 @@
+package libvirt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	libvirt "github.com/digitalocean/go-libvirt"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"libvirt.org/go/libvirtxml"
+)
+
+// stepUploadNvramTemplate generates a variable store with the Secure Boot keys of the build enrolled
+// and uploads it as the NVRAM template of the domain. libvirt copies the template into the NVRAM of the domain
+// when it's started the first time, so the template is only kept for the duration of the build.
+type stepUploadNvramTemplate struct {
+	volume *libvirt.StorageVol
+}
+
+func (s *stepUploadNvramTemplate) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+
+	if config.SecureBootKeys == nil {
+		return multistep.ActionContinue
+	}
+
+	ui := state.Get("ui").(packersdk.Ui)
+	driver := state.Get("driver").(*libvirt.Libvirt)
+	domainDef := state.Get("domain_def").(*libvirtxml.Domain)
+	keys := config.SecureBootKeys
+	name := fmt.Sprintf("%s-VARS.fd", config.DomainName)
+
+	ui.Say(fmt.Sprintf("Generating the NVRAM template with Secure Boot keys owned by %s", keys.OwnerGuid))
+
+	store, err := keys.VariableStore()
+	if err != nil {
+		return haltOnError(ui, state, "Error while generating the NVRAM template: %s", err)
+	}
+
+	pool, err := driver.StoragePoolLookupByName(keys.Pool)
+	if err != nil {
+		return haltOnError(ui, state, "Couldn't find storage pool %s for the NVRAM template: %s", keys.Pool, err)
+	}
+
+	if existing, err := driver.StorageVolLookupByName(pool, name); err == nil {
+		ui.Message(fmt.Sprintf("Replacing the NVRAM template %s/%s left behind by a previous build", keys.Pool, name))
+		if err := driver.StorageVolDelete(existing, libvirt.StorageVolDeleteNormal); err != nil {
+			return haltOnError(ui, state, "Couldn't delete the NVRAM template %s/%s: %s", keys.Pool, name, err)
+		}
+	}
+
+	volumeDef := libvirtxml.StorageVolume{
+		Name: name,
+		Capacity: &libvirtxml.StorageVolumeSize{
+			Value: uint64(len(store)),
+			Unit:  "B",
+		},
+		Target: &libvirtxml.StorageVolumeTarget{
+			Format: &libvirtxml.StorageVolumeTargetFormat{Type: "raw"},
+		},
+	}
+	volumeXml, err := volumeDef.Marshal()
+	if err != nil {
+		return haltOnError(ui, state, "Error while creating the definition of the NVRAM template: %s", err)
+	}
+
+	volume, err := driver.StorageVolCreateXML(pool, volumeXml, 0)
+	if err != nil {
+		return haltOnError(ui, state, "Couldn't create the NVRAM template %s/%s: %s", keys.Pool, name, err)
+	}
+	s.volume = &volume
+
+	if err := driver.StorageVolUpload(volume, bytes.NewReader(store), 0, uint64(len(store)), 0); err != nil {
+		return haltOnError(ui, state, "Couldn't upload the NVRAM template %s/%s: %s", keys.Pool, name, err)
+	}
+
+	path, err := driver.StorageVolGetPath(volume)
+	if err != nil {
+		return haltOnError(ui, state, "Couldn't get the path of the NVRAM template %s/%s: %s", keys.Pool, name, err)
+	}
+
+	domainDef.OS.NVRam = &libvirtxml.DomainNVRam{
+		Template: path,
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *stepUploadNvramTemplate) Cleanup(state multistep.StateBag) {
+	if s.volume == nil {
+		return
+	}
+
+	ui := state.Get("ui").(packersdk.Ui)
+	driver := state.Get("driver").(*libvirt.Libvirt)
+
+	ui.Say(fmt.Sprintf("Deleting the NVRAM template %s/%s", s.volume.Pool, s.volume.Name))
+	if err := driver.StorageVolDelete(*s.volume, libvirt.StorageVolDeleteNormal); err != nil {
+		ui.Error(fmt.Sprintf("Couldn't delete the NVRAM template %s/%s: %s", s.volume.Pool, s.volume.Name, err))
+	}
+	s.volume = nil
+}
@@ -0,0 +1,75 @@
+package volume
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+	"libvirt.org/go/libvirtxml"
+)
+
+// waitForBlockJobReady waits until the mirroring block job (a block copy or an active commit) running on the disk
+// has copied everything and keeps the two sides in sync. Only then can it be pivoted or completed.
+// The job is cancelled if the context is done first or its progress can't be read,
+// so the disk isn't left with a half-finished mirror.
+func waitForBlockJobReady(ctx context.Context, driver *libvirt.Libvirt, domain libvirt.Domain, disk string) error {
+	err := pollBlockJob(ctx, driver, domain, disk)
+	if err != nil {
+		if abortErr := driver.DomainBlockJobAbort(domain, disk, 0); abortErr != nil {
+			log.Printf("Failed to abort block job of disk %s: %s\n", disk, abortErr)
+		}
+	}
+	return err
+}
+
+func pollBlockJob(ctx context.Context, driver *libvirt.Libvirt, domain libvirt.Domain, disk string) error {
+	for {
+		found, _, _, cur, end, err := driver.DomainGetBlockJobInfo(domain, disk, 0)
+		if err != nil {
+			return fmt.Errorf("DomainGetBlockJobInfo: %s", err)
+		}
+		if found == 0 {
+			return fmt.Errorf("block job of disk %s disappeared", disk)
+		}
+
+		log.Printf("Block job of disk %s: %d/%d\n", disk, cur, end)
+
+		ready, err := blockJobIsReady(driver, domain, disk)
+		if err != nil {
+			return err
+		}
+		if ready {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// blockJobIsReady reads the readiness of the mirror from the live definition of the domain,
+// the block job info alone can't tell an empty job from a finished one.
+func blockJobIsReady(driver *libvirt.Libvirt, domain libvirt.Domain, disk string) (bool, error) {
+	rawDomainDef, err := driver.DomainGetXMLDesc(domain, 0)
+	if err != nil {
+		return false, fmt.Errorf("DomainGetXMLDesc: %s", err)
+	}
+
+	domainDef := &libvirtxml.Domain{}
+	if err = domainDef.Unmarshal(rawDomainDef); err != nil {
+		return false, fmt.Errorf("DomainUnmarshal: %s", err)
+	}
+
+	for _, d := range domainDef.Devices.Disks {
+		if d.Target != nil && d.Target.Dev == disk {
+			return d.Mirror != nil && d.Mirror.Ready == "yes", nil
+		}
+	}
+
+	return false, fmt.Errorf("disk %s not found in the domain", disk)
+}
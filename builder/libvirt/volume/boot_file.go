@@ -0,0 +1,47 @@
+package volume
+
+import (
+	"fmt"
+)
+
+// Boot files of a direct kernel boot
+const (
+	BootFileKernel = "kernel"
+	BootFileInitrd = "initrd"
+	BootFileDtb    = "dtb"
+)
+
+// NewBootFileVolume creates a volume holding a file of a direct kernel boot, like the kernel or the initrd.
+// The file is fetched like an external volume source, but the volume is never attached to the domain as a disk,
+// the hypervisor reads it from the path of the volume instead. It's always deleted at the end of the build.
+func NewBootFileVolume(pool string, domainName string, bootFile string, url string) Volume {
+	return Volume{
+		Pool:       pool,
+		Name:       fmt.Sprintf("%s-%s", domainName, bootFile),
+		Format:     "raw",
+		Device:     "disk",
+		Bus:        "virtio",
+		OnConflict: ConflictReplace,
+		Source: &VolumeSource{
+			Type: "external",
+			External: ExternalVolumeSource{
+				Urls: []string{url},
+			},
+		},
+		bootFile:   bootFile,
+		nameSuffix: bootFile,
+	}
+}
+
+// BootFile returns which file of a direct kernel boot the volume holds, if any
+func (v *Volume) BootFile() string {
+	return v.bootFile
+}
+
+// BootFilePath returns the path of the prepared boot file on the libvirt host
+func (pctx *PreparationContext) BootFilePath() (string, error) {
+	if pctx.VolumeDefinition == nil || pctx.VolumeDefinition.Target == nil || pctx.VolumeDefinition.Target.Path == "" {
+		return "", fmt.Errorf("the %s volume %s/%s has no path, boot files need a file based pool like a dir pool", pctx.VolumeConfig.bootFile, pctx.VolumeConfig.Pool, pctx.VolumeConfig.Name)
+	}
+	return pctx.VolumeDefinition.Target.Path, nil
+}
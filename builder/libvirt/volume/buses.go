@@ -0,0 +1,33 @@
+package volume
+
+import (
+	"fmt"
+
+	libvirtutils "github.com/thomasklein94/packer-plugin-libvirt/libvirt-utils"
+)
+
+// Buses which are emulated by QEMU and need a machine with PCI to plug their controllers into
+var pciControllerBuses = []string{"nvme", "usb"}
+
+// RequiresPciController reports whether the bus of the volume needs a controller on the PCI bus of the machine
+func (v *Volume) RequiresPciController() bool {
+	return libvirtutils.ContainsString(pciControllerBuses, v.Bus)
+}
+
+// prepareBus validates the settings which only some buses support
+func (v *Volume) prepareBus() (errs []error) {
+	if v.Removable && v.Bus != "usb" {
+		errs = append(errs, fmt.Errorf("only usb disks can be removable, volume %s/%s is on %s", v.Pool, v.Name, v.Bus))
+	}
+
+	if v.Bus == "nvme" {
+		if v.Device != "disk" {
+			errs = append(errs, fmt.Errorf("the nvme bus only supports disks, volume %s/%s is a %s", v.Pool, v.Name, v.Device))
+		}
+		if v.Controller != nil {
+			errs = append(errs, fmt.Errorf("every nvme disk has a controller of its own, controller can't be set for volume %s/%s", v.Pool, v.Name))
+		}
+	}
+
+	return
+}
@@ -6,14 +6,18 @@ import (
 	"fmt"
 	"log"
 
+	"github.com/digitalocean/go-libvirt"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
 	"libvirt.org/go/libvirtxml"
 )
 
+// Clone an existing volume, possibly from another pool. The clone keeps the format of the source volume,
+// unless the volume sets a `format`, in which case the contents are converted. The clone is grown to the volume's
+// `capacity` (or `size`) if it's larger than the source, otherwise it keeps the capacity of the source.
 type CloningVolumeSource struct {
 	// Specifies the name of the storage pool (managed by libvirt) where the disk source resides
-	Pool string `mapstucture:"pool" required:"false"`
+	Pool string `mapstructure:"pool" required:"false"`
 	// Specifies the name of storage volume (managed by libvirt) used as the disk source.
 	Volume string `mapstructure:"volume" required:"false"`
 }
@@ -33,57 +37,65 @@ func (vs *CloningVolumeSource) PrepareConfig(ctx *interpolate.Context, vol *Volu
 	return
 }
 
-func (vs *CloningVolumeSource) UpdateDomainDiskXml(domainDisk *libvirtxml.DomainDisk) {
-	if domainDisk.Driver == nil {
-		domainDisk.Driver = &libvirtxml.DomainDiskDriver{}
-	}
-	domainDisk.Driver.Type = "qcow2"
-}
+func (vs *CloningVolumeSource) UpdateDomainDiskXml(domainDisk *libvirtxml.DomainDisk) {}
 
-func (vs *CloningVolumeSource) UpdateStorageDefinitionXml(storageDef *libvirtxml.StorageVolume) {
-	if storageDef.Target == nil {
-		storageDef.Target = &libvirtxml.StorageVolumeTarget{}
-	}
-	if storageDef.Target.Format == nil {
-		storageDef.Target.Format = &libvirtxml.StorageVolumeTargetFormat{}
-	}
-	storageDef.Target.Format.Type = "qcow2"
-}
+func (vs *CloningVolumeSource) UpdateStorageDefinitionXml(storageDef *libvirtxml.StorageVolume) {}
 
 func (vs *CloningVolumeSource) PrepareVolume(pctx *PreparationContext) multistep.StepAction {
-	backingPool, err := pctx.Driver.StoragePoolLookupByName(vs.Pool)
+	sourcePool, err := pctx.Driver.StoragePoolLookupByName(vs.Pool)
 	if err != nil {
 		return pctx.HaltOnError(err, "CloningVolumeSource.PoolLookup: %s", err)
 	}
 
-	backingVol, err := pctx.Driver.StorageVolLookupByName(backingPool, vs.Volume)
+	sourceVol, err := pctx.Driver.StorageVolLookupByName(sourcePool, vs.Volume)
 	if err != nil {
 		return pctx.HaltOnError(err, "CloningVolumeSource.VolumeLookup: %s", err)
 	}
 
-	rawXML, err := pctx.Driver.StorageVolGetXMLDesc(backingVol, 0)
+	return pctx.cloneFrom(sourceVol)
+}
+
+// cloneFrom creates the volume as a copy of another volume, keeping the source's format unless
+// the volume asks for a specific one, then grows it to the requested capacity.
+func (pctx *PreparationContext) cloneFrom(sourceVol libvirt.StorageVol) multistep.StepAction {
+	rawXML, err := pctx.Driver.StorageVolGetXMLDesc(sourceVol, 0)
 	if err != nil {
-		return pctx.HaltOnError(err, "CloningVolumeSource.GetXMLDescription: %s", err)
+		return pctx.HaltOnError(err, "CloneVolume.GetXMLDescription: %s", err)
 	}
 
-	backingVolDef := &libvirtxml.StorageVolume{}
-	err = backingVolDef.Unmarshal(rawXML)
+	sourceVolDef := &libvirtxml.StorageVolume{}
+	if err = sourceVolDef.Unmarshal(rawXML); err != nil {
+		return pctx.HaltOnError(err, "CloneVolume.Unmarshal: %s", err)
+	}
 
-	if err != nil {
-		return pctx.HaltOnError(err, "CloningVolumeSource.Unmarshal: %s", err)
+	volumeDef := pctx.VolumeDefinition
+	requestedCapacity := volumeDef.Capacity
+	volumeDef.Capacity = sourceVolDef.Capacity
+
+	inheritsFormat := pctx.VolumeConfig.inheritsSourceFormat()
+
+	if (volumeDef.Target == nil || volumeDef.Target.Format == nil) && sourceVolDef.Target != nil && sourceVolDef.Target.Format != nil {
+		if volumeDef.Target == nil {
+			volumeDef.Target = &libvirtxml.StorageVolumeTarget{}
+		}
+		volumeDef.Target.Format = &libvirtxml.StorageVolumeTargetFormat{Type: sourceVolDef.Target.Format.Type}
+		// The disk has to be attached in the format of the clone
+		pctx.VolumeConfig.Format = sourceVolDef.Target.Format.Type
 	}
 
-	err = pctx.CloneVolumeFrom(backingPool, backingVol)
+	if inheritsFormat {
+		if err = pctx.VolumeConfig.updateQcow2Features(volumeDef); err != nil {
+			return pctx.HaltOnError(err, "Volume %s/%s: %s", pctx.VolumeConfig.Pool, pctx.VolumeConfig.Name, err)
+		}
+	}
 
-	if err != nil {
+	if err = pctx.CloneVolumeFrom(sourceVol); err != nil {
 		return pctx.HaltOnError(err, "%s", err)
 	}
 
-	err = pctx.RefreshVolumeDefinition()
-
-	if err != nil {
+	if err = pctx.RefreshVolumeDefinition(); err != nil {
 		log.Printf("Error while refreshing volume definition: %s\n", err)
 	}
 
-	return multistep.ActionContinue
+	return pctx.growToCapacity(requestedCapacity)
 }
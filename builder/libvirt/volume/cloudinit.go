@@ -30,7 +30,8 @@ type CloudInitSource struct {
 
 func (vs *CloudInitSource) PrepareConfig(ctx *interpolate.Context, vol *Volume, domainName string) (warnings []string, errs []error) {
 	if vol.Name == "" {
-		vol.Name = fmt.Sprintf("%s-cloudinit", domainName)
+		vol.nameSuffix = "cloudinit"
+		vol.Name = fmt.Sprintf("%s-%s", domainName, vol.nameSuffix)
 	}
 
 	vol.allowUnspecifiedSize = true
@@ -0,0 +1,80 @@
+package volume
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+// Policies for volumes whose name is already taken in their pool
+const (
+	ConflictFail    = "fail"
+	ConflictReplace = "replace"
+	ConflictReuse   = "reuse"
+	ConflictRename  = "rename"
+)
+
+// resolveConflict looks for an existing volume with the same name and applies the volume's on_conflict policy.
+// It doesn't delete anything, a volume to be replaced is only checked and recorded in the preparation context.
+func (v *Volume) resolveConflict(pctx *PreparationContext) multistep.StepAction {
+	existing, err := pctx.Driver.StorageVolLookupByName(*pctx.PoolRef, v.Name)
+
+	if err != nil {
+		if v.UpdateInPlace {
+			return pctx.HaltOnError(err, "Volume %s/%s has to exist to be updated in place: %s", v.Pool, v.Name, err)
+		}
+		if v.Source == nil && !pctx.VolumeIsArtifact && v.OnConflict == ConflictReuse {
+			return pctx.HaltOnError(err, "Error while looking up volume %s/%s: %s", v.Pool, v.Name, err)
+		}
+		return multistep.ActionContinue
+	}
+
+	switch v.OnConflict {
+	case ConflictReuse:
+		pctx.VolumeRef = &existing
+		pctx.VolumeIsCreated = false
+		pctx.VolumeIsReused = true
+
+	case ConflictReplace:
+		users, err := VolumeUsers(pctx.Driver, existing)
+		if err != nil {
+			return pctx.HaltOnError(err, "Couldn't check whether volume %s/%s is in use: %s", v.Pool, v.Name, err)
+		}
+		if len(users) > 0 {
+			return pctx.HaltOnError(nil, "Volume %s/%s can't be replaced, it's still used by %s", v.Pool, v.Name, strings.Join(users, ", "))
+		}
+		pctx.volumeToReplace = &existing
+
+	case ConflictRename:
+		name, err := freeVolumeName(pctx.Driver, *pctx.PoolRef, v.Name)
+		if err != nil {
+			return pctx.HaltOnError(err, "Couldn't find a free name for volume %s/%s: %s", v.Pool, v.Name, err)
+		}
+		pctx.Ui.Message(fmt.Sprintf("Volume %s/%s already exists, using the name '%s' instead", v.Pool, v.Name, name))
+		v.Name = name
+
+	default:
+		return pctx.HaltOnError(nil, "Volume %s/%s already exists. Set on_conflict to replace, reuse or rename to build with it anyway", v.Pool, v.Name)
+	}
+
+	return multistep.ActionContinue
+}
+
+// freeVolumeName returns the first name of the form `<name>-<n>` not taken in the pool.
+// The extension of the name, like `.qcow2`, is kept at the end.
+func freeVolumeName(driver *libvirt.Libvirt, pool libvirt.StoragePool, name string) (string, error) {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	for i := 1; i < 1000; i++ {
+		candidate := fmt.Sprintf("%s-%d%s", base, i, ext)
+		if _, err := driver.StorageVolLookupByName(pool, candidate); err != nil {
+			return candidate, nil
+		}
+	}
+
+	return "", fmt.Errorf("every name from %s-1%s to %s-999%s is taken", base, ext, base, ext)
+}
@@ -0,0 +1,311 @@
+package volume
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"libvirt.org/go/libvirtxml"
+)
+
+const asciiLower = "abcdefghijklmnopqrstuvwxyz"
+
+// Device name prefixes of the buses, see the target element at https://libvirt.org/formatdomain.html#hard-drives-floppy-disks-cdroms
+var busDevicePrefixes = map[string]string{
+	"fdc":    "fd",
+	"ide":    "hd",
+	"virtio": "vd",
+	"xen":    "xvd",
+	"scsi":   "sd",
+	"sata":   "sd",
+	"usb":    "sd",
+	"sd":     "sd",
+	"nvme":   nvmePrefix,
+}
+
+// NVMe disks are named after their controller and namespace. Every NVMe disk gets a controller of its own,
+// so the disks are the first namespaces of controllers 0, 1, 2, ... like `nvme0n1`, `nvme1n1`.
+const nvmePrefix = "nvme"
+
+var nvmeDevicePattern = regexp.MustCompile(`^nvme(0|[1-9][0-9]*)n1$`)
+
+// The number of devices a bus can address, if it's limited
+var busDeviceLimits = map[string]int{
+	"fdc": 2,
+}
+
+// Buses whose disks get a drive address: the number of units on one controller and the number of buses of a controller
+type driveAddressing struct {
+	units int
+	buses int
+}
+
+// These mirror the addresses libvirt itself would assign to the disks of the bus.
+// SCSI disks go to virtio-scsi controllers unless a controller of another model is declared.
+var busDriveAddressing = map[string]driveAddressing{
+	"scsi": {units: VirtioScsiUnits, buses: 1},
+	"sata": {units: 6, buses: 1},
+	"ide":  {units: 2, buses: 2},
+	"fdc":  {units: 2, buses: 1},
+}
+
+// The number of units of a virtio-scsi controller
+const VirtioScsiUnits = 16384
+
+// The number of units of the emulated, narrow SCSI controllers, like the LSI Logic one
+const NarrowScsiUnits = 7
+
+// DeviceAllocator hands out target device names and drive addresses to the disks of one domain.
+// Explicit targets have to be reserved before any name is allocated, so generated names never collide with them.
+type DeviceAllocator struct {
+	// Every device name in use, reserved or allocated
+	used map[string]bool
+	// The next index to try per device name prefix
+	nextIndex map[string]int
+	// The number of drive addresses handed out per bus and controller
+	usedSlots map[string]map[int]int
+	// The first controller per bus which might still have a free slot for disks without a pinned controller
+	nextController map[string]int
+	// The number of units of the controllers whose model differs from the default of their bus
+	controllerUnits map[string]map[int]int
+}
+
+func NewDeviceAllocator() *DeviceAllocator {
+	return &DeviceAllocator{
+		used:            map[string]bool{},
+		nextIndex:       map[string]int{},
+		usedSlots:       map[string]map[int]int{},
+		nextController:  map[string]int{},
+		controllerUnits: map[string]map[int]int{},
+	}
+}
+
+func devicePrefix(bus string) string {
+	if prefix, ok := busDevicePrefixes[bus]; ok {
+		return prefix
+	}
+	return "sd"
+}
+
+// Reserve marks an explicitly set target device as used. The name has to match the bus, like `vdb` on `virtio`.
+func (a *DeviceAllocator) Reserve(bus string, dev string) error {
+	prefix := devicePrefix(bus)
+
+	index, ok := deviceNameToIndex(prefix, dev)
+	if !ok {
+		return fmt.Errorf("target device '%s' is not a valid device name on the %s bus, expected a name like %s", dev, bus, deviceIndexToName(prefix, 0))
+	}
+
+	if limit, ok := busDeviceLimits[bus]; ok && index >= limit {
+		return fmt.Errorf("target device '%s' is out of range, the %s bus can only have %d devices", dev, bus, limit)
+	}
+
+	if a.used[dev] {
+		return fmt.Errorf("target device '%s' is used by more than one volume", dev)
+	}
+
+	a.used[dev] = true
+	return nil
+}
+
+// Allocate returns the first unused device name of the bus, like `sda`, `sdz`, `sdaa`.
+func (a *DeviceAllocator) Allocate(bus string) (string, error) {
+	prefix := devicePrefix(bus)
+
+	for index := a.nextIndex[prefix]; ; index++ {
+		if limit, ok := busDeviceLimits[bus]; ok && index >= limit {
+			return "", fmt.Errorf("the %s bus has used up all of its %d devices", bus, limit)
+		}
+
+		dev := deviceIndexToName(prefix, index)
+		if !a.used[dev] {
+			a.used[dev] = true
+			a.nextIndex[prefix] = index + 1
+			return dev, nil
+		}
+	}
+}
+
+// SetControllerUnits sets the number of units of a controller, if its model takes a different number of disks
+// than the default of the bus. It has to be called before any address is handed out.
+func (a *DeviceAllocator) SetControllerUnits(bus string, controller int, units int) {
+	if a.controllerUnits[bus] == nil {
+		a.controllerUnits[bus] = map[int]int{}
+	}
+	a.controllerUnits[bus][controller] = units
+}
+
+// HasDriveAddresses reports whether the disks of the bus are addressed by controller and unit
+func HasDriveAddresses(bus string) bool {
+	_, ok := busDriveAddressing[bus]
+	return ok
+}
+
+func (a *DeviceAllocator) controllerSlots(bus string, controller int) int {
+	addressing := busDriveAddressing[bus]
+	units := addressing.units
+	if u, ok := a.controllerUnits[bus][controller]; ok {
+		units = u
+	}
+	return units * addressing.buses
+}
+
+// Address returns the next free drive address of the bus, filling up one controller before moving to the next,
+// like the SCSI unit numbers of a controller. Buses without drive addresses, like `virtio`, get nil.
+func (a *DeviceAllocator) Address(bus string) *libvirtxml.DomainAddress {
+	if !HasDriveAddresses(bus) {
+		return nil
+	}
+
+	controller := a.nextController[bus]
+	for a.usedSlots[bus][controller] >= a.controllerSlots(bus, controller) {
+		controller++
+	}
+	a.nextController[bus] = controller
+
+	// A controller always has a free slot at this point
+	address, _ := a.AddressOnController(bus, controller)
+	return address
+}
+
+// AddressOnController returns the next free drive address on the given controller of the bus
+func (a *DeviceAllocator) AddressOnController(bus string, controller int) (*libvirtxml.DomainAddress, error) {
+	addressing, ok := busDriveAddressing[bus]
+	if !ok {
+		return nil, fmt.Errorf("disks on the %s bus can't be assigned to a controller", bus)
+	}
+
+	if controller < 0 {
+		return nil, fmt.Errorf("controller index can't be negative")
+	}
+
+	slots := a.controllerSlots(bus, controller)
+	slot := a.usedSlots[bus][controller]
+	if slot >= slots {
+		return nil, fmt.Errorf("%s controller %d is full, it can only have %d disks", bus, controller, slots)
+	}
+
+	if a.usedSlots[bus] == nil {
+		a.usedSlots[bus] = map[int]int{}
+	}
+	a.usedSlots[bus][controller] = slot + 1
+
+	units := slots / addressing.buses
+	controllerIndex := uint(controller)
+	busIndex := uint(slot / units)
+	target := uint(0)
+	unit := uint(slot % units)
+
+	return &libvirtxml.DomainAddress{
+		Drive: &libvirtxml.DomainAddressDrive{
+			Controller: &controllerIndex,
+			Bus:        &busIndex,
+			Target:     &target,
+			Unit:       &unit,
+		},
+	}, nil
+}
+
+// nvmeAddress is the address of the first namespace of the given NVMe controller
+func nvmeAddress(controller int) *libvirtxml.DomainAddress {
+	controllerIndex := uint(controller)
+	zero := uint(0)
+	return &libvirtxml.DomainAddress{
+		Drive: &libvirtxml.DomainAddressDrive{
+			Controller: &controllerIndex,
+			Bus:        &zero,
+			Target:     &zero,
+			Unit:       &zero,
+		},
+	}
+}
+
+// deviceIndexToName turns a zero based index into a device name the way libvirt does: 0 is `a`, 25 is `z`, 26 is `aa`.
+func deviceIndexToName(prefix string, index int) string {
+	if prefix == nvmePrefix {
+		return fmt.Sprintf("nvme%dn1", index)
+	}
+
+	suffix := ""
+	for i := index; i >= 0; i = i/26 - 1 {
+		suffix = string(asciiLower[i%26]) + suffix
+	}
+	return prefix + suffix
+}
+
+// deviceNameToIndex is the inverse of deviceIndexToName. Partition numbers are not accepted.
+func deviceNameToIndex(prefix string, dev string) (int, bool) {
+	if prefix == nvmePrefix {
+		match := nvmeDevicePattern.FindStringSubmatch(dev)
+		if match == nil {
+			return 0, false
+		}
+		index, err := strconv.Atoi(match[1])
+		return index, err == nil
+	}
+
+	suffix := strings.TrimPrefix(dev, prefix)
+	if suffix == dev || suffix == "" {
+		return 0, false
+	}
+
+	index := 0
+	for _, c := range suffix {
+		if c < 'a' || c > 'z' {
+			return 0, false
+		}
+		index = index*26 + int(c-'a') + 1
+	}
+	return index - 1, true
+}
+
+// ReserveTargetDev reserves the explicitly set target device of the volume, if any
+func (v *Volume) ReserveTargetDev(allocator *DeviceAllocator) error {
+	if v.TargetDev == "" {
+		return nil
+	}
+
+	if err := allocator.Reserve(v.Bus, v.TargetDev); err != nil {
+		return fmt.Errorf("volume %s/%s: %s", v.Pool, v.Name, err)
+	}
+	return nil
+}
+
+// AssignDevice allocates a target device for the volume unless it has one set explicitly,
+// and gives the disk the next drive address of its bus
+func (v *Volume) AssignDevice(allocator *DeviceAllocator) error {
+	if v.TargetDev == "" {
+		dev, err := allocator.Allocate(v.Bus)
+		if err != nil {
+			return fmt.Errorf("volume %s/%s: %s", v.Pool, v.Name, err)
+		}
+		v.TargetDev = dev
+	}
+
+	if v.Bus == "nvme" {
+		index, _ := deviceNameToIndex(nvmePrefix, v.TargetDev)
+		v.address = nvmeAddress(index)
+		return nil
+	}
+
+	if v.Controller == nil {
+		v.address = allocator.Address(v.Bus)
+		return nil
+	}
+
+	address, err := allocator.AddressOnController(v.Bus, *v.Controller)
+	if err != nil {
+		return fmt.Errorf("volume %s/%s: %s", v.Pool, v.Name, err)
+	}
+	v.address = address
+	return nil
+}
+
+// DriveController returns the bus and the index of the controller the disk is attached to, if it has a drive address
+func (v *Volume) DriveController() (string, int, bool) {
+	if v.address == nil || v.address.Drive == nil || v.address.Drive.Controller == nil {
+		return "", 0, false
+	}
+	return v.Bus, int(*v.address.Drive.Controller), true
+}
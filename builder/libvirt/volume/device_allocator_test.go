@@ -0,0 +1,268 @@
+package volume_test
+
+import (
+	"testing"
+
+	"github.com/thomasklein94/packer-plugin-libvirt/builder/libvirt/volume"
+)
+
+func TestAllocateBeyondTwentySixDevices(t *testing.T) {
+	allocator := volume.NewDeviceAllocator()
+
+	expectations := map[int]string{
+		0:   "sda",
+		25:  "sdz",
+		26:  "sdaa",
+		27:  "sdab",
+		51:  "sdaz",
+		52:  "sdba",
+		701: "sdzz",
+		702: "sdaaa",
+	}
+
+	for i := 0; i <= 702; i++ {
+		dev, err := allocator.Allocate("scsi")
+		if err != nil {
+			t.Fatalf("allocation %d failed: %s", i, err)
+		}
+		if expected, ok := expectations[i]; ok && dev != expected {
+			t.Errorf("allocation %d: expected %s, got %s", i, expected, dev)
+		}
+	}
+}
+
+func TestAllocateSkipsReservedTargets(t *testing.T) {
+	allocator := volume.NewDeviceAllocator()
+
+	for _, dev := range []string{"vda", "vdc"} {
+		if err := allocator.Reserve("virtio", dev); err != nil {
+			t.Fatalf("couldn't reserve %s: %s", dev, err)
+		}
+	}
+
+	for _, expected := range []string{"vdb", "vdd", "vde"} {
+		dev, err := allocator.Allocate("virtio")
+		if err != nil {
+			t.Fatalf("allocation failed: %s", err)
+		}
+		if dev != expected {
+			t.Errorf("expected %s, got %s", expected, dev)
+		}
+	}
+}
+
+func TestBusesSharingAPrefixShareTheNames(t *testing.T) {
+	allocator := volume.NewDeviceAllocator()
+
+	if err := allocator.Reserve("sata", "sda"); err != nil {
+		t.Fatalf("couldn't reserve sda: %s", err)
+	}
+
+	dev, err := allocator.Allocate("scsi")
+	if err != nil {
+		t.Fatalf("allocation failed: %s", err)
+	}
+	if dev != "sdb" {
+		t.Errorf("expected sdb, got %s", dev)
+	}
+
+	dev, err = allocator.Allocate("ide")
+	if err != nil {
+		t.Fatalf("allocation failed: %s", err)
+	}
+	if dev != "hda" {
+		t.Errorf("expected hda, got %s", dev)
+	}
+}
+
+func TestInvalidReservations(t *testing.T) {
+	allocator := volume.NewDeviceAllocator()
+
+	if err := allocator.Reserve("scsi", "sdb"); err != nil {
+		t.Fatalf("couldn't reserve sdb: %s", err)
+	}
+
+	invalid := []struct {
+		bus string
+		dev string
+	}{
+		{"scsi", "sdb"},
+		{"scsi", "vdb"},
+		{"virtio", "vd"},
+		{"virtio", "vdb1"},
+		{"virtio", "vdB"},
+		{"fdc", "fdc"},
+	}
+
+	for _, reservation := range invalid {
+		if err := allocator.Reserve(reservation.bus, reservation.dev); err == nil {
+			t.Errorf("reserving %s on the %s bus should have failed", reservation.dev, reservation.bus)
+		}
+	}
+}
+
+func TestFloppyLimit(t *testing.T) {
+	allocator := volume.NewDeviceAllocator()
+
+	for _, expected := range []string{"fda", "fdb"} {
+		dev, err := allocator.Allocate("fdc")
+		if err != nil {
+			t.Fatalf("allocation failed: %s", err)
+		}
+		if dev != expected {
+			t.Errorf("expected %s, got %s", expected, dev)
+		}
+	}
+
+	if dev, err := allocator.Allocate("fdc"); err == nil {
+		t.Errorf("a third floppy should have been refused, got %s", dev)
+	}
+}
+
+func TestDriveAddresses(t *testing.T) {
+	allocator := volume.NewDeviceAllocator()
+	allocator.SetControllerUnits("scsi", 0, volume.NarrowScsiUnits)
+
+	type drive struct {
+		controller, bus, unit uint
+	}
+
+	expectations := map[string][]drive{
+		"scsi": {{0, 0, 0}, {0, 0, 1}, {0, 0, 2}, {0, 0, 3}, {0, 0, 4}, {0, 0, 5}, {0, 0, 6}, {1, 0, 0}},
+		"sata": {{0, 0, 0}, {0, 0, 1}, {0, 0, 2}, {0, 0, 3}, {0, 0, 4}, {0, 0, 5}, {1, 0, 0}},
+		"ide":  {{0, 0, 0}, {0, 0, 1}, {0, 1, 0}, {0, 1, 1}, {1, 0, 0}},
+	}
+
+	for _, bus := range []string{"scsi", "sata", "ide"} {
+		for i, expected := range expectations[bus] {
+			address := allocator.Address(bus)
+			if address == nil || address.Drive == nil {
+				t.Fatalf("%s disk %d got no drive address", bus, i)
+			}
+			got := drive{*address.Drive.Controller, *address.Drive.Bus, *address.Drive.Unit}
+			if got != expected {
+				t.Errorf("%s disk %d: expected %+v, got %+v", bus, i, expected, got)
+			}
+		}
+	}
+
+	if address := allocator.Address("virtio"); address != nil {
+		t.Errorf("virtio disks shouldn't get a drive address, got %+v", address)
+	}
+}
+
+func TestAllocatorsAreIndependent(t *testing.T) {
+	first := volume.NewDeviceAllocator()
+	second := volume.NewDeviceAllocator()
+
+	if _, err := first.Allocate("virtio"); err != nil {
+		t.Fatalf("allocation failed: %s", err)
+	}
+
+	dev, err := second.Allocate("virtio")
+	if err != nil {
+		t.Fatalf("allocation failed: %s", err)
+	}
+	if dev != "vda" {
+		t.Errorf("expected vda from a new allocator, got %s", dev)
+	}
+}
+
+func TestVirtioScsiControllerTakesManyDisks(t *testing.T) {
+	allocator := volume.NewDeviceAllocator()
+
+	for i := 0; i < 100; i++ {
+		address := allocator.Address("scsi")
+		if *address.Drive.Controller != 0 || *address.Drive.Unit != uint(i) {
+			t.Fatalf("scsi disk %d: expected controller 0 unit %d, got controller %d unit %d", i, i, *address.Drive.Controller, *address.Drive.Unit)
+		}
+	}
+}
+
+func TestAddressOnController(t *testing.T) {
+	allocator := volume.NewDeviceAllocator()
+	allocator.SetControllerUnits("scsi", 1, volume.NarrowScsiUnits)
+
+	for i := 0; i < volume.NarrowScsiUnits; i++ {
+		address, err := allocator.AddressOnController("scsi", 1)
+		if err != nil {
+			t.Fatalf("scsi disk %d on controller 1: %s", i, err)
+		}
+		if *address.Drive.Controller != 1 || *address.Drive.Unit != uint(i) {
+			t.Errorf("scsi disk %d: expected controller 1 unit %d, got controller %d unit %d", i, i, *address.Drive.Controller, *address.Drive.Unit)
+		}
+	}
+
+	if _, err := allocator.AddressOnController("scsi", 1); err == nil {
+		t.Errorf("a full controller should have refused another disk")
+	}
+
+	// Pinned disks don't take the slots of the other controllers
+	address := allocator.Address("scsi")
+	if *address.Drive.Controller != 0 || *address.Drive.Unit != 0 {
+		t.Errorf("expected controller 0 unit 0, got controller %d unit %d", *address.Drive.Controller, *address.Drive.Unit)
+	}
+
+	if _, err := allocator.AddressOnController("virtio", 0); err == nil {
+		t.Errorf("virtio disks shouldn't be assigned to a controller")
+	}
+}
+
+func TestAutomaticAddressesSkipFullControllers(t *testing.T) {
+	allocator := volume.NewDeviceAllocator()
+
+	for i := 0; i < 6; i++ {
+		if _, err := allocator.AddressOnController("sata", 0); err != nil {
+			t.Fatalf("sata disk %d on controller 0: %s", i, err)
+		}
+	}
+
+	address := allocator.Address("sata")
+	if *address.Drive.Controller != 1 || *address.Drive.Unit != 0 {
+		t.Errorf("expected controller 1 unit 0, got controller %d unit %d", *address.Drive.Controller, *address.Drive.Unit)
+	}
+}
+
+func TestNvmeDeviceNames(t *testing.T) {
+	allocator := volume.NewDeviceAllocator()
+
+	if err := allocator.Reserve("nvme", "nvme1n1"); err != nil {
+		t.Fatalf("couldn't reserve nvme1n1: %s", err)
+	}
+
+	for _, expected := range []string{"nvme0n1", "nvme2n1", "nvme3n1"} {
+		dev, err := allocator.Allocate("nvme")
+		if err != nil {
+			t.Fatalf("allocation failed: %s", err)
+		}
+		if dev != expected {
+			t.Errorf("expected %s, got %s", expected, dev)
+		}
+	}
+
+	for _, dev := range []string{"nvme0n2", "nvmea", "nvme01n1", "nvme1n1", "sda"} {
+		if err := allocator.Reserve("nvme", dev); err == nil {
+			t.Errorf("reserving %s on the nvme bus should have failed", dev)
+		}
+	}
+}
+
+func TestUsbDisksShareTheScsiNames(t *testing.T) {
+	allocator := volume.NewDeviceAllocator()
+
+	if _, err := allocator.Allocate("scsi"); err != nil {
+		t.Fatalf("allocation failed: %s", err)
+	}
+
+	dev, err := allocator.Allocate("usb")
+	if err != nil {
+		t.Fatalf("allocation failed: %s", err)
+	}
+	if dev != "sdb" {
+		t.Errorf("expected sdb, got %s", dev)
+	}
+
+	if address := allocator.Address("usb"); address != nil {
+		t.Errorf("usb disks shouldn't get a drive address, got %+v", address)
+	}
+}
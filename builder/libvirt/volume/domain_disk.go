@@ -0,0 +1,234 @@
+//go:generate go run github.com/hashicorp/packer-plugin-sdk/cmd/packer-sdc struct-markdown
+
+package volume
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+	"libvirt.org/go/libvirtxml"
+)
+
+// Copy a disk of an existing domain into the new volume. A running domain keeps running, its disk is copied with
+// a block copy, which is finished without switching the domain over to the copy once the copy is in sync.
+// The disk of a stopped domain is cloned instead, which requires the disk to be a volume of a storage pool.
+// The capacity of the new volume defaults to the capacity of the disk.
+type DomainDiskVolumeSource struct {
+	// The name of the existing domain whose disk is copied.
+	Domain string `mapstructure:"domain" required:"true"`
+	// The disk of the domain to copy, given either by its target device (like `vda`) or by its alias.
+	Disk string `mapstructure:"disk" required:"true"`
+	// Freeze the filesystems of a running domain through the QEMU guest agent while the copy is being finished,
+	// so the copy is consistent at the filesystem level instead of just crash-consistent.
+	// The build fails if the filesystems can't be frozen.
+	Quiesce bool `mapstructure:"quiesce" required:"false"`
+}
+
+func (vs *DomainDiskVolumeSource) PrepareConfig(ctx *interpolate.Context, vol *Volume) (warnings []string, errs []error) {
+	errs = []error{}
+
+	if vs.Domain == "" {
+		errs = append(errs, fmt.Errorf("domain volume source missing domain name"))
+	}
+	if vs.Disk == "" {
+		errs = append(errs, fmt.Errorf("domain volume source missing disk target or alias"))
+	}
+
+	vol.allowUnspecifiedSize = true
+
+	return
+}
+
+func (vs *DomainDiskVolumeSource) UpdateDomainDiskXml(domainDisk *libvirtxml.DomainDisk) {
+}
+
+func (vs *DomainDiskVolumeSource) UpdateStorageDefinitionXml(storageDef *libvirtxml.StorageVolume) {
+}
+
+func (vs *DomainDiskVolumeSource) PrepareVolume(pctx *PreparationContext) multistep.StepAction {
+	domain, err := pctx.Driver.DomainLookupByName(vs.Domain)
+	if err != nil {
+		return pctx.HaltOnError(err, "DomainDiskVolumeSource.DomainLookup: %s", err)
+	}
+
+	active, err := pctx.Driver.DomainIsActive(domain)
+	if err != nil {
+		return pctx.HaltOnError(err, "DomainDiskVolumeSource.IsActive: %s", err)
+	}
+
+	rawDomainDef, err := pctx.Driver.DomainGetXMLDesc(domain, 0)
+	if err != nil {
+		return pctx.HaltOnError(err, "DomainDiskVolumeSource.GetXMLDescription: %s", err)
+	}
+
+	domainDef := &libvirtxml.Domain{}
+	if err = domainDef.Unmarshal(rawDomainDef); err != nil {
+		return pctx.HaltOnError(err, "DomainDiskVolumeSource.Unmarshal: %s", err)
+	}
+
+	disk := vs.findDisk(domainDef)
+	if disk == nil {
+		return pctx.HaltOnError(nil, "Domain %s has no disk with target or alias '%s'", vs.Domain, vs.Disk)
+	}
+
+	if active == 1 {
+		return vs.blockCopy(pctx, domain, disk)
+	}
+
+	return vs.cloneStoppedDisk(pctx, disk)
+}
+
+func (vs *DomainDiskVolumeSource) findDisk(domainDef *libvirtxml.Domain) *libvirtxml.DomainDisk {
+	if domainDef.Devices == nil {
+		return nil
+	}
+
+	for i, disk := range domainDef.Devices.Disks {
+		if disk.Target != nil && disk.Target.Dev == vs.Disk {
+			return &domainDef.Devices.Disks[i]
+		}
+		if disk.Alias != nil && (disk.Alias.Name == vs.Disk || disk.Alias.Name == "ua-"+vs.Disk) {
+			return &domainDef.Devices.Disks[i]
+		}
+	}
+
+	return nil
+}
+
+// cloneStoppedDisk clones the volume behind the disk of a domain which is not running,
+// nothing writes into the disk in that case.
+func (vs *DomainDiskVolumeSource) cloneStoppedDisk(pctx *PreparationContext, disk *libvirtxml.DomainDisk) multistep.StepAction {
+	sourceVol, err := diskVolume(pctx.Driver, disk)
+	if err != nil {
+		return pctx.HaltOnError(err, "Disk %s of domain %s: %s", vs.Disk, vs.Domain, err)
+	}
+
+	pctx.Ui.Message(fmt.Sprintf("Cloning volume %s/%s of stopped domain %s", sourceVol.Pool, sourceVol.Name, vs.Domain))
+
+	return pctx.cloneFrom(sourceVol)
+}
+
+// blockCopy mirrors the disk of a running domain into the new volume. Once the mirror is in sync,
+// the job is cancelled without pivoting, which leaves the new volume as a point in time copy of the disk.
+func (vs *DomainDiskVolumeSource) blockCopy(pctx *PreparationContext, domain libvirt.Domain, disk *libvirtxml.DomainDisk) multistep.StepAction {
+	target := disk.Target.Dev
+
+	if pctx.VolumeConfig.Capacity == "" {
+		_, capacity, _, err := pctx.Driver.DomainGetBlockInfo(domain, target, 0)
+		if err != nil {
+			return pctx.HaltOnError(err, "DomainDiskVolumeSource.GetBlockInfo: %s", err)
+		}
+		pctx.VolumeDefinition.Capacity = &libvirtxml.StorageVolumeSize{Value: capacity, Unit: "B"}
+	}
+
+	if pctx.VolumeConfig.inheritsSourceFormat() {
+		if err := pctx.VolumeConfig.updateQcow2Features(pctx.VolumeDefinition); err != nil {
+			return pctx.HaltOnError(err, "Volume %s/%s: %s", pctx.VolumeConfig.Pool, pctx.VolumeConfig.Name, err)
+		}
+	}
+
+	if err := pctx.CreateVolume(); err != nil {
+		return pctx.HaltOnError(err, "%s", err)
+	}
+
+	destXML, err := vs.copyDestinationXml(pctx)
+	if err != nil {
+		return pctx.HaltOnError(err, "DomainDiskVolumeSource.Destination: %s", err)
+	}
+
+	pctx.Ui.Message(fmt.Sprintf("Copying disk %s of running domain %s", target, vs.Domain))
+
+	flags := libvirt.DomainBlockCopyReuseExt | libvirt.DomainBlockCopyTransientJob
+	if err = pctx.Driver.DomainBlockCopy(domain, target, destXML, nil, flags); err != nil {
+		return pctx.HaltOnError(err, "DomainDiskVolumeSource.BlockCopy: %s", err)
+	}
+
+	if err = waitForBlockJobReady(pctx.Context, pctx.Driver, domain, target); err != nil {
+		return pctx.HaltOnError(err, "Error while copying disk %s of domain %s: %s", target, vs.Domain, err)
+	}
+
+	if vs.Quiesce {
+		if _, err = pctx.Driver.DomainFsfreeze(domain, nil, 0); err != nil {
+			_ = pctx.Driver.DomainBlockJobAbort(domain, target, 0)
+			return pctx.HaltOnError(err, "Couldn't freeze the filesystems of domain %s: %s", vs.Domain, err)
+		}
+	}
+
+	err = pctx.Driver.DomainBlockJobAbort(domain, target, 0)
+
+	if vs.Quiesce {
+		if _, thawErr := pctx.Driver.DomainFsthaw(domain, nil, 0); thawErr != nil {
+			pctx.Ui.Error(fmt.Sprintf("Couldn't thaw the filesystems of domain %s: %s", vs.Domain, thawErr))
+		}
+	}
+
+	if err != nil {
+		return pctx.HaltOnError(err, "DomainDiskVolumeSource.BlockJobAbort: %s", err)
+	}
+
+	if err = pctx.RefreshVolumeDefinition(); err != nil {
+		log.Printf("Error while refreshing volume definition: %s\n", err)
+	}
+
+	return multistep.ActionContinue
+}
+
+// copyDestinationXml describes the new volume as the destination of a block copy
+func (vs *DomainDiskVolumeSource) copyDestinationXml(pctx *PreparationContext) (string, error) {
+	path, err := pctx.Driver.StorageVolGetPath(*pctx.VolumeRef)
+	if err != nil {
+		return "", err
+	}
+
+	volType, _, _, err := pctx.Driver.StorageVolGetInfo(*pctx.VolumeRef)
+	if err != nil {
+		return "", err
+	}
+
+	dest := &libvirtxml.DomainDisk{Source: &libvirtxml.DomainDiskSource{}}
+	if libvirt.StorageVolType(volType) == libvirt.StorageVolBlock {
+		dest.Source.Block = &libvirtxml.DomainDiskSourceBlock{Dev: path}
+	} else {
+		dest.Source.File = &libvirtxml.DomainDiskSourceFile{File: path}
+	}
+
+	if pctx.VolumeDefinition.Target != nil && pctx.VolumeDefinition.Target.Format != nil {
+		dest.Driver = &libvirtxml.DomainDiskDriver{Type: pctx.VolumeDefinition.Target.Format.Type}
+	}
+
+	return dest.Marshal()
+}
+
+// diskVolume finds the storage volume behind a disk of a domain
+func diskVolume(driver *libvirt.Libvirt, disk *libvirtxml.DomainDisk) (libvirt.StorageVol, error) {
+	if disk.Source == nil {
+		return libvirt.StorageVol{}, fmt.Errorf("the disk has no source")
+	}
+
+	switch {
+	case disk.Source.Volume != nil:
+		pool, err := driver.StoragePoolLookupByName(disk.Source.Volume.Pool)
+		if err != nil {
+			return libvirt.StorageVol{}, err
+		}
+		return driver.StorageVolLookupByName(pool, disk.Source.Volume.Volume)
+	case disk.Source.File != nil:
+		return volumeByPath(driver, disk.Source.File.File)
+	case disk.Source.Block != nil:
+		return volumeByPath(driver, disk.Source.Block.Dev)
+	}
+
+	return libvirt.StorageVol{}, fmt.Errorf("only volume, file and block disks can be copied")
+}
+
+func volumeByPath(driver *libvirt.Libvirt, path string) (libvirt.StorageVol, error) {
+	vol, err := driver.StorageVolLookupByPath(path)
+	if err != nil && strings.Contains(err.Error(), "no storage vol") {
+		return vol, fmt.Errorf("%s is not in any storage pool, it can only be copied while the domain is running", path)
+	}
+	return vol, err
+}
@@ -0,0 +1,55 @@
+package volume
+
+import (
+	"fmt"
+	"regexp"
+
+	libvirtutils "github.com/thomasklein94/packer-plugin-libvirt/libvirt-utils"
+)
+
+var (
+	diskCacheModes        = []string{"default", "none", "writethrough", "writeback", "directsync", "unsafe"}
+	diskIOModes           = []string{"threads", "native", "io_uring"}
+	diskDiscardModes      = []string{"ignore", "unmap"}
+	diskDetectZeroesModes = []string{"off", "on", "unmap"}
+
+	diskSerialPattern = regexp.MustCompile(`^[A-Za-z0-9_.+ -]{1,20}$`)
+	diskWWNPattern    = regexp.MustCompile(`^[0-9A-Fa-f]{16}$`)
+)
+
+// prepareDriverTuning validates the optional performance and identification settings of the disk
+func (v *Volume) prepareDriverTuning() (errs []error) {
+	check := func(setting string, value string, allowed []string) {
+		if value != "" && !libvirtutils.ContainsString(allowed, value) {
+			errs = append(errs, fmt.Errorf("unknown %s '%s' for volume %s/%s, must be one of %v", setting, value, v.Pool, v.Name, allowed))
+		}
+	}
+
+	check("cache", v.Cache, diskCacheModes)
+	check("io", v.IO, diskIOModes)
+	check("discard", v.Discard, diskDiscardModes)
+	check("detect_zeroes", v.DetectZeroes, diskDetectZeroesModes)
+
+	if v.IO == "native" && v.Cache != "none" && v.Cache != "directsync" {
+		errs = append(errs, fmt.Errorf("io = native requires cache to be none or directsync for volume %s/%s", v.Pool, v.Name))
+	}
+
+	if v.IOThread != 0 && v.Bus != "virtio" {
+		errs = append(errs, fmt.Errorf("iothread is only supported on the virtio bus, volume %s/%s is on %s", v.Pool, v.Name, v.Bus))
+	}
+
+	if v.Serial != "" && !diskSerialPattern.MatchString(v.Serial) {
+		errs = append(errs, fmt.Errorf("serial '%s' of volume %s/%s must be at most 20 letters, digits, spaces or any of _.+-", v.Serial, v.Pool, v.Name))
+	}
+
+	if v.WWN != "" {
+		if !diskWWNPattern.MatchString(v.WWN) {
+			errs = append(errs, fmt.Errorf("wwn '%s' of volume %s/%s must be 16 hexadecimal digits", v.WWN, v.Pool, v.Name))
+		}
+		if v.Bus != "scsi" && v.Bus != "ide" {
+			errs = append(errs, fmt.Errorf("wwn is only supported on the scsi and ide buses, volume %s/%s is on %s", v.Pool, v.Name, v.Bus))
+		}
+	}
+
+	return
+}
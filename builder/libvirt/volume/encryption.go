@@ -0,0 +1,117 @@
+package volume
+
+import (
+	"fmt"
+
+	"libvirt.org/go/libvirtxml"
+)
+
+// prepareEncryption validates the encryption settings of the volume
+func (v *Volume) prepareEncryption() (errs []error) {
+	if v.Encryption == "" {
+		if v.EncryptionPassphrase != "" {
+			errs = append(errs, fmt.Errorf("encryption_passphrase is set, but encryption isn't for volume %s/%s", v.Pool, v.Name))
+		}
+		return
+	}
+
+	if v.Encryption != "luks" {
+		errs = append(errs, fmt.Errorf("unknown encryption '%s' for volume %s/%s, only luks is supported", v.Encryption, v.Pool, v.Name))
+	}
+
+	if v.EncryptionPassphrase == "" {
+		errs = append(errs, fmt.Errorf("encryption_passphrase is required for the encrypted volume %s/%s", v.Pool, v.Name))
+	}
+
+	// The contents of sources would overwrite the LUKS header of the new volume
+	if v.Source != nil {
+		errs = append(errs, fmt.Errorf("only volumes without a source can be encrypted, volume %s/%s has a %s source", v.Pool, v.Name, v.Source.Type))
+	}
+
+	if v.UpdateInPlace {
+		errs = append(errs, fmt.Errorf("volume %s/%s can't be both encrypted and updated in place", v.Pool, v.Name))
+	}
+
+	if v.Format != "" && v.Format != "raw" && v.Format != "qcow2" {
+		errs = append(errs, fmt.Errorf("only raw and qcow2 volumes can be encrypted, volume %s/%s is %s", v.Pool, v.Name, v.Format))
+	}
+
+	return
+}
+
+// defineEncryptionSecret creates an ephemeral, private libvirt secret holding the passphrase
+// and adds the encryption to the definition of the volume to be created.
+func (pctx *PreparationContext) defineEncryptionSecret() error {
+	v := pctx.VolumeConfig
+
+	secretDef := &libvirtxml.Secret{
+		Ephemeral:   "yes",
+		Private:     "yes",
+		Description: fmt.Sprintf("Passphrase of volume %s/%s, defined by packer-plugin-libvirt", v.Pool, v.Name),
+	}
+
+	secretXML, err := secretDef.Marshal()
+	if err != nil {
+		return fmt.Errorf("DefineSecret.Marshal: %s", err)
+	}
+
+	secret, err := pctx.Driver.SecretDefineXML(secretXML, 0)
+	if err != nil {
+		return fmt.Errorf("DefineSecret.RPC: %s", err)
+	}
+	pctx.EncryptionSecret = &secret
+
+	if err = pctx.Driver.SecretSetValue(secret, []byte(v.EncryptionPassphrase), 0); err != nil {
+		return fmt.Errorf("SetSecretValue.RPC: %s", err)
+	}
+
+	if pctx.VolumeDefinition.Target == nil {
+		pctx.VolumeDefinition.Target = &libvirtxml.StorageVolumeTarget{}
+	}
+	pctx.VolumeDefinition.Target.Encryption = &libvirtxml.StorageEncryption{
+		Format: v.Encryption,
+		Secret: &libvirtxml.StorageEncryptionSecret{
+			Type: "passphrase",
+			UUID: pctx.EncryptionSecretUUID(),
+		},
+	}
+
+	return nil
+}
+
+// EncryptionSecretUUID returns the UUID of the secret holding the passphrase of the volume, if any
+func (pctx *PreparationContext) EncryptionSecretUUID() string {
+	if pctx.EncryptionSecret == nil {
+		return ""
+	}
+	u := pctx.EncryptionSecret.UUID
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+// UndefineEncryptionSecret removes the secret holding the passphrase of the volume from libvirt
+func (pctx *PreparationContext) UndefineEncryptionSecret() error {
+	if pctx.EncryptionSecret == nil {
+		return nil
+	}
+
+	if err := pctx.Driver.SecretUndefine(*pctx.EncryptionSecret); err != nil {
+		return err
+	}
+
+	pctx.EncryptionSecret = nil
+	return nil
+}
+
+func (pctx *PreparationContext) updateDomainDiskEncryption(domainDisk *libvirtxml.DomainDisk) {
+	if pctx.EncryptionSecret == nil {
+		return
+	}
+
+	domainDisk.Encryption = &libvirtxml.DomainDiskEncryption{
+		Format: pctx.VolumeConfig.Encryption,
+		Secret: &libvirtxml.DomainDiskSecret{
+			Type: "passphrase",
+			UUID: pctx.EncryptionSecretUUID(),
+		},
+	}
+}
@@ -4,8 +4,10 @@ package volume
 
 import (
 	"fmt"
-	"log"
+	"net/http"
+	"net/url"
 	"os"
+	"time"
 
 	"github.com/hashicorp/packer-plugin-sdk/multistep/commonsteps"
 	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
@@ -24,6 +26,13 @@ type ExternalVolumeSource struct {
 	Checksum string `mapstructure:"checksum"`
 	// A list of URLs from where this volume can be obtained
 	Urls []string `mapstructure:"urls"`
+	// Where the image is downloaded. `runner` (the default) downloads it on the machine running Packer,
+	// caches it and uploads it through libvirt. `host` downloads it on the libvirt host with `curl` or `wget`,
+	// straight into the directory of the pool, using the SSH connection of a `qemu+ssh` libvirt URI.
+	// Only `http`, `https` and `ftp` URLs and dir pools are supported with `host`, and nothing is cached.
+	// With a local libvirt connection, `host` is the same machine, so the image is downloaded like with `runner`
+	// and a warning is printed.
+	FetchOn string `mapstructure:"fetch_on"`
 }
 
 func (vs *ExternalVolumeSource) PrepareConfig(ctx *interpolate.Context, vol *Volume) (warnings []string, errs []error) {
@@ -32,6 +41,20 @@ func (vs *ExternalVolumeSource) PrepareConfig(ctx *interpolate.Context, vol *Vol
 		errs = append(errs, fmt.Errorf("at least 1 URL must be specified for an external volume source"))
 	}
 
+	switch vs.FetchOn {
+	case "":
+		vs.FetchOn = "runner"
+	case "runner":
+	case "host":
+		for _, u := range vs.Urls {
+			if parsed, err := url.Parse(u); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https" && parsed.Scheme != "ftp") {
+				errs = append(errs, fmt.Errorf("only http, https and ftp URLs can be fetched on the host, got '%s'", u))
+			}
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown fetch_on '%s', must be runner or host", vs.FetchOn))
+	}
+
 	vol.allowUnspecifiedSize = true
 
 	return
@@ -42,6 +65,15 @@ func (vs *ExternalVolumeSource) UpdateDomainDiskXml(domainDisk *libvirtxml.Domai
 func (vs *ExternalVolumeSource) UpdateStorageDefinitionXml(storageDef *libvirtxml.StorageVolume) {}
 
 func (vs *ExternalVolumeSource) PrepareVolume(pctx *PreparationContext) multistep.StepAction {
+	// A host local to the runner gains nothing from fetching on its own
+	if vs.FetchOn == "host" && !pctx.LocalConnection {
+		storageTargetCapacity := pctx.VolumeDefinition.Capacity
+		if action := vs.fetchOnHost(pctx); action != multistep.ActionContinue {
+			return action
+		}
+		return pctx.resizeToCapacity(storageTargetCapacity)
+	}
+
 	tmpState := multistep.BasicStateBag{}
 	tmpState.Put("ui", pctx.Ui)
 	resultKey := "path"
@@ -82,55 +114,45 @@ func (vs *ExternalVolumeSource) PrepareVolume(pctx *PreparationContext) multiste
 		Unit:  "B",
 	}
 
-	err = pctx.CreateVolume()
+	err = pctx.transferFile(path, libvirt.StorageVolUploadSparseStream)
 	if err != nil {
-		return pctx.HaltOnError(err, "%s", err)
-	}
-
-	f, err := os.Open(path)
-
-	if err != nil {
-		return pctx.HaltOnError(err, "preparing volume: %s", err)
+		return pctx.HaltOnError(err, "Error during volume transfer: %s", err)
 	}
 
-	err = pctx.Driver.StorageVolUpload(*pctx.VolumeRef, f, 0, uint64(stat.Size()), libvirt.StorageVolUploadSparseStream)
-
-	if err != nil {
-		connectUri, _ := pctx.Driver.ConnectGetUri()
-
-		// The test backend does not support Volume Uploads, so
-		if connectUri[0:4] == "test" {
-			pctx.Ui.Error(fmt.Sprintf("Error during volume streaming: %s", err))
-		} else {
-			return pctx.HaltOnError(err, "Error during volume streaming: %s", err)
-		}
-	}
+	return pctx.resizeToCapacity(storageTargetCapacity)
+}
 
-	err = pctx.RefreshVolumeDefinition()
+// sourceSize tells the size of the image from the first URL it's known for:
+// the size of a local file or the Content-Length of an HTTP URL.
+func (vs *ExternalVolumeSource) sourceSize() (uint64, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
 
-	if err != nil {
-		log.Printf("Error while refreshing volume definition: %s\n", err)
-	}
-
-	if storageTargetCapacity != nil {
-		pctx.Ui.Message(fmt.Sprintf(
-			"Resizing volume %s/%s to meet capacity %d%s",
-			pctx.VolumeConfig.Pool,
-			pctx.VolumeConfig.Name,
-			storageTargetCapacity.Value,
-			storageTargetCapacity.Unit,
-		))
-		multiplier, err := unitToMultiplier(storageTargetCapacity.Unit)
+	for _, u := range vs.Urls {
+		parsed, err := url.Parse(u)
 		if err != nil {
-			return pctx.HaltOnError(err, "Error during volume resize: %s", err)
+			continue
 		}
-		targetCapacityInBytes := storageTargetCapacity.Value * uint64(multiplier)
 
-		err = pctx.Driver.StorageVolResize(*pctx.VolumeRef, targetCapacityInBytes, 0)
-		if err != nil {
-			return pctx.HaltOnError(err, "Error during volume resize: %s", err)
+		switch parsed.Scheme {
+		case "", "file":
+			path := parsed.Path
+			if parsed.Scheme == "" {
+				path = u
+			}
+			if fInfo, err := os.Stat(path); err == nil {
+				return uint64(fInfo.Size()), nil
+			}
+		case "http", "https":
+			resp, err := client.Head(u)
+			if err != nil {
+				continue
+			}
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK && resp.ContentLength > 0 {
+				return uint64(resp.ContentLength), nil
+			}
 		}
 	}
 
-	return multistep.ActionContinue
+	return 0, fmt.Errorf("the size of the image is unknown until it's downloaded, set capacity to include it")
 }
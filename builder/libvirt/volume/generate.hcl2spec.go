@@ -37,7 +37,7 @@ func (*FlatBackingStoreVolumeSource) HCL2Spec() map[string]hcldec.Spec {
 // FlatCloningVolumeSource is an auto-generated flat version of CloningVolumeSource.
 // Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
 type FlatCloningVolumeSource struct {
-	Pool   *string `mapstucture:"pool" required:"false" cty:"pool" hcl:"pool"`
+	Pool   *string `mapstructure:"pool" required:"false" cty:"pool" hcl:"pool"`
 	Volume *string `mapstructure:"volume" required:"false" cty:"volume" hcl:"volume"`
 }
 
@@ -86,11 +86,39 @@ func (*FlatCloudInitSource) HCL2Spec() map[string]hcldec.Spec {
 	return s
 }
 
+// FlatDomainDiskVolumeSource is an auto-generated flat version of DomainDiskVolumeSource.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatDomainDiskVolumeSource struct {
+	Domain  *string `mapstructure:"domain" required:"true" cty:"domain" hcl:"domain"`
+	Disk    *string `mapstructure:"disk" required:"true" cty:"disk" hcl:"disk"`
+	Quiesce *bool   `mapstructure:"quiesce" required:"false" cty:"quiesce" hcl:"quiesce"`
+}
+
+// FlatMapstructure returns a new FlatDomainDiskVolumeSource.
+// FlatDomainDiskVolumeSource is an auto-generated flat version of DomainDiskVolumeSource.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*DomainDiskVolumeSource) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatDomainDiskVolumeSource)
+}
+
+// HCL2Spec returns the hcl spec of a DomainDiskVolumeSource.
+// This spec is used by HCL to read the fields of DomainDiskVolumeSource.
+// The decoded values from this spec will then be applied to a FlatDomainDiskVolumeSource.
+func (*FlatDomainDiskVolumeSource) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"domain":  &hcldec.AttrSpec{Name: "domain", Type: cty.String, Required: false},
+		"disk":    &hcldec.AttrSpec{Name: "disk", Type: cty.String, Required: false},
+		"quiesce": &hcldec.AttrSpec{Name: "quiesce", Type: cty.Bool, Required: false},
+	}
+	return s
+}
+
 // FlatExternalVolumeSource is an auto-generated flat version of ExternalVolumeSource.
 // Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
 type FlatExternalVolumeSource struct {
 	Checksum *string  `mapstructure:"checksum" cty:"checksum" hcl:"checksum"`
 	Urls     []string `mapstructure:"urls" cty:"urls" hcl:"urls"`
+	FetchOn  *string  `mapstructure:"fetch_on" cty:"fetch_on" hcl:"fetch_on"`
 }
 
 // FlatMapstructure returns a new FlatExternalVolumeSource.
@@ -107,6 +135,34 @@ func (*FlatExternalVolumeSource) HCL2Spec() map[string]hcldec.Spec {
 	s := map[string]hcldec.Spec{
 		"checksum": &hcldec.AttrSpec{Name: "checksum", Type: cty.String, Required: false},
 		"urls":     &hcldec.AttrSpec{Name: "urls", Type: cty.List(cty.String), Required: false},
+		"fetch_on": &hcldec.AttrSpec{Name: "fetch_on", Type: cty.String, Required: false},
+	}
+	return s
+}
+
+// FlatFilesVolumeSource is an auto-generated flat version of FilesVolumeSource.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatFilesVolumeSource struct {
+	Files    []string          `mapstructure:"files" cty:"files" hcl:"files"`
+	Contents map[string]string `mapstructure:"contents" cty:"contents" hcl:"contents"`
+	Label    *string           `mapstructure:"label" cty:"label" hcl:"label"`
+}
+
+// FlatMapstructure returns a new FlatFilesVolumeSource.
+// FlatFilesVolumeSource is an auto-generated flat version of FilesVolumeSource.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*FilesVolumeSource) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatFilesVolumeSource)
+}
+
+// HCL2Spec returns the hcl spec of a FilesVolumeSource.
+// This spec is used by HCL to read the fields of FilesVolumeSource.
+// The decoded values from this spec will then be applied to a FlatFilesVolumeSource.
+func (*FlatFilesVolumeSource) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"files":    &hcldec.AttrSpec{Name: "files", Type: cty.List(cty.String), Required: false},
+		"contents": &hcldec.AttrSpec{Name: "contents", Type: cty.Map(cty.String), Required: false},
+		"label":    &hcldec.AttrSpec{Name: "label", Type: cty.String, Required: false},
 	}
 	return s
 }
@@ -114,17 +170,37 @@ func (*FlatExternalVolumeSource) HCL2Spec() map[string]hcldec.Spec {
 // FlatVolume is an auto-generated flat version of Volume.
 // Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
 type FlatVolume struct {
-	Pool      *string           `mapstructure:"pool" required:"false" cty:"pool" hcl:"pool"`
-	Name      *string           `mapstructure:"name" required:"false" cty:"name" hcl:"name"`
-	Source    *FlatVolumeSource `mapstructure:"source" required:"false" cty:"source" hcl:"source"`
-	Size      *string           `mapstructure:"size" required:"false" cty:"size" hcl:"size"`
-	Capacity  *string           `mapstructure:"capacity" required:"false" cty:"capacity" hcl:"capacity"`
-	ReadOnly  *bool             `mapstructure:"readonly" required:"false" cty:"readonly" hcl:"readonly"`
-	TargetDev *string           `mapstructure:"target_dev" required:"false" cty:"target_dev" hcl:"target_dev"`
-	Bus       *string           `mapstructure:"bus" required:"false" cty:"bus" hcl:"bus"`
-	Alias     *string           `mapstructure:"alias" required:"false" cty:"alias" hcl:"alias"`
-	Format    *string           `mapstructure:"format" required:"false" cty:"format" hcl:"format"`
-	Device    *string           `mapstructure:"device" required:"false" cty:"device" hcl:"device"`
+	Pool                 *string           `mapstructure:"pool" required:"false" cty:"pool" hcl:"pool"`
+	Name                 *string           `mapstructure:"name" required:"false" cty:"name" hcl:"name"`
+	Source               *FlatVolumeSource `mapstructure:"source" required:"false" cty:"source" hcl:"source"`
+	Size                 *string           `mapstructure:"size" required:"false" cty:"size" hcl:"size"`
+	Capacity             *string           `mapstructure:"capacity" required:"false" cty:"capacity" hcl:"capacity"`
+	ReadOnly             *bool             `mapstructure:"readonly" required:"false" cty:"readonly" hcl:"readonly"`
+	TargetDev            *string           `mapstructure:"target_dev" required:"false" cty:"target_dev" hcl:"target_dev"`
+	Bus                  *string           `mapstructure:"bus" required:"false" cty:"bus" hcl:"bus"`
+	BootOrder            *uint             `mapstructure:"boot_order" required:"false" cty:"boot_order" hcl:"boot_order"`
+	Removable            *bool             `mapstructure:"removable" required:"false" cty:"removable" hcl:"removable"`
+	Controller           *int              `mapstructure:"controller" required:"false" cty:"controller" hcl:"controller"`
+	Alias                *string           `mapstructure:"alias" required:"false" cty:"alias" hcl:"alias"`
+	Format               *string           `mapstructure:"format" required:"false" cty:"format" hcl:"format"`
+	Device               *string           `mapstructure:"device" required:"false" cty:"device" hcl:"device"`
+	Type                 *string           `mapstructure:"type" required:"false" cty:"type" hcl:"type"`
+	Path                 *string           `mapstructure:"path" required:"false" cty:"path" hcl:"path"`
+	OnConflict           *string           `mapstructure:"on_conflict" required:"false" cty:"on_conflict" hcl:"on_conflict"`
+	UpdateInPlace        *bool             `mapstructure:"update_in_place" required:"false" cty:"update_in_place" hcl:"update_in_place"`
+	Cache                *string           `mapstructure:"cache" required:"false" cty:"cache" hcl:"cache"`
+	IO                   *string           `mapstructure:"io" required:"false" cty:"io" hcl:"io"`
+	Discard              *string           `mapstructure:"discard" required:"false" cty:"discard" hcl:"discard"`
+	DetectZeroes         *string           `mapstructure:"detect_zeroes" required:"false" cty:"detect_zeroes" hcl:"detect_zeroes"`
+	IOThread             *uint             `mapstructure:"iothread" required:"false" cty:"iothread" hcl:"iothread"`
+	Serial               *string           `mapstructure:"serial" required:"false" cty:"serial" hcl:"serial"`
+	Compat               *string           `mapstructure:"compat" required:"false" cty:"compat" hcl:"compat"`
+	LazyRefcounts        *bool             `mapstructure:"lazy_refcounts" required:"false" cty:"lazy_refcounts" hcl:"lazy_refcounts"`
+	ClusterSize          *string           `mapstructure:"cluster_size" required:"false" cty:"cluster_size" hcl:"cluster_size"`
+	Preallocation        *string           `mapstructure:"preallocation" required:"false" cty:"preallocation" hcl:"preallocation"`
+	Encryption           *string           `mapstructure:"encryption" required:"false" cty:"encryption" hcl:"encryption"`
+	EncryptionPassphrase *string           `mapstructure:"encryption_passphrase" required:"false" cty:"encryption_passphrase" hcl:"encryption_passphrase"`
+	WWN                  *string           `mapstructure:"wwn" required:"false" cty:"wwn" hcl:"wwn"`
 }
 
 // FlatMapstructure returns a new FlatVolume.
@@ -139,17 +215,37 @@ func (*Volume) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec }
 // The decoded values from this spec will then be applied to a FlatVolume.
 func (*FlatVolume) HCL2Spec() map[string]hcldec.Spec {
 	s := map[string]hcldec.Spec{
-		"pool":       &hcldec.AttrSpec{Name: "pool", Type: cty.String, Required: false},
-		"name":       &hcldec.AttrSpec{Name: "name", Type: cty.String, Required: false},
-		"source":     &hcldec.BlockSpec{TypeName: "source", Nested: hcldec.ObjectSpec((*FlatVolumeSource)(nil).HCL2Spec())},
-		"size":       &hcldec.AttrSpec{Name: "size", Type: cty.String, Required: false},
-		"capacity":   &hcldec.AttrSpec{Name: "capacity", Type: cty.String, Required: false},
-		"readonly":   &hcldec.AttrSpec{Name: "readonly", Type: cty.Bool, Required: false},
-		"target_dev": &hcldec.AttrSpec{Name: "target_dev", Type: cty.String, Required: false},
-		"bus":        &hcldec.AttrSpec{Name: "bus", Type: cty.String, Required: false},
-		"alias":      &hcldec.AttrSpec{Name: "alias", Type: cty.String, Required: false},
-		"format":     &hcldec.AttrSpec{Name: "format", Type: cty.String, Required: false},
-		"device":     &hcldec.AttrSpec{Name: "device", Type: cty.String, Required: false},
+		"pool":                  &hcldec.AttrSpec{Name: "pool", Type: cty.String, Required: false},
+		"name":                  &hcldec.AttrSpec{Name: "name", Type: cty.String, Required: false},
+		"source":                &hcldec.BlockSpec{TypeName: "source", Nested: hcldec.ObjectSpec((*FlatVolumeSource)(nil).HCL2Spec())},
+		"size":                  &hcldec.AttrSpec{Name: "size", Type: cty.String, Required: false},
+		"capacity":              &hcldec.AttrSpec{Name: "capacity", Type: cty.String, Required: false},
+		"readonly":              &hcldec.AttrSpec{Name: "readonly", Type: cty.Bool, Required: false},
+		"target_dev":            &hcldec.AttrSpec{Name: "target_dev", Type: cty.String, Required: false},
+		"bus":                   &hcldec.AttrSpec{Name: "bus", Type: cty.String, Required: false},
+		"boot_order":            &hcldec.AttrSpec{Name: "boot_order", Type: cty.Number, Required: false},
+		"removable":             &hcldec.AttrSpec{Name: "removable", Type: cty.Bool, Required: false},
+		"controller":            &hcldec.AttrSpec{Name: "controller", Type: cty.Number, Required: false},
+		"alias":                 &hcldec.AttrSpec{Name: "alias", Type: cty.String, Required: false},
+		"format":                &hcldec.AttrSpec{Name: "format", Type: cty.String, Required: false},
+		"device":                &hcldec.AttrSpec{Name: "device", Type: cty.String, Required: false},
+		"type":                  &hcldec.AttrSpec{Name: "type", Type: cty.String, Required: false},
+		"path":                  &hcldec.AttrSpec{Name: "path", Type: cty.String, Required: false},
+		"on_conflict":           &hcldec.AttrSpec{Name: "on_conflict", Type: cty.String, Required: false},
+		"update_in_place":       &hcldec.AttrSpec{Name: "update_in_place", Type: cty.Bool, Required: false},
+		"cache":                 &hcldec.AttrSpec{Name: "cache", Type: cty.String, Required: false},
+		"io":                    &hcldec.AttrSpec{Name: "io", Type: cty.String, Required: false},
+		"discard":               &hcldec.AttrSpec{Name: "discard", Type: cty.String, Required: false},
+		"detect_zeroes":         &hcldec.AttrSpec{Name: "detect_zeroes", Type: cty.String, Required: false},
+		"iothread":              &hcldec.AttrSpec{Name: "iothread", Type: cty.Number, Required: false},
+		"serial":                &hcldec.AttrSpec{Name: "serial", Type: cty.String, Required: false},
+		"compat":                &hcldec.AttrSpec{Name: "compat", Type: cty.String, Required: false},
+		"lazy_refcounts":        &hcldec.AttrSpec{Name: "lazy_refcounts", Type: cty.Bool, Required: false},
+		"cluster_size":          &hcldec.AttrSpec{Name: "cluster_size", Type: cty.String, Required: false},
+		"preallocation":         &hcldec.AttrSpec{Name: "preallocation", Type: cty.String, Required: false},
+		"encryption":            &hcldec.AttrSpec{Name: "encryption", Type: cty.String, Required: false},
+		"encryption_passphrase": &hcldec.AttrSpec{Name: "encryption_passphrase", Type: cty.String, Required: false},
+		"wwn":                   &hcldec.AttrSpec{Name: "wwn", Type: cty.String, Required: false},
 	}
 	return s
 }
@@ -158,8 +254,10 @@ func (*FlatVolume) HCL2Spec() map[string]hcldec.Spec {
 // Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
 type FlatVolumeSource struct {
 	Type          *string           `mapstructure:"type" required:"true" cty:"type" hcl:"type"`
+	VerifyUpload  *string           `mapstructure:"verify_upload" required:"false" cty:"verify_upload" hcl:"verify_upload"`
 	Checksum      *string           `mapstructure:"checksum" cty:"checksum" hcl:"checksum"`
 	Urls          []string          `mapstructure:"urls" cty:"urls" hcl:"urls"`
+	FetchOn       *string           `mapstructure:"fetch_on" cty:"fetch_on" hcl:"fetch_on"`
 	MetaData      *string           `mapstructure:"meta_data" cty:"meta_data" hcl:"meta_data"`
 	UserData      *string           `mapstructure:"user_data" cty:"user_data" hcl:"user_data"`
 	NetworkConfig *string           `mapstructure:"network_config" cty:"network_config" hcl:"network_config"`
@@ -169,6 +267,9 @@ type FlatVolumeSource struct {
 	Files         []string          `mapstructure:"files" cty:"files" hcl:"files"`
 	Contents      map[string]string `mapstructure:"contents" cty:"contents" hcl:"contents"`
 	Label         *string           `mapstructure:"label" cty:"label" hcl:"label"`
+	Domain        *string           `mapstructure:"domain" required:"true" cty:"domain" hcl:"domain"`
+	Disk          *string           `mapstructure:"disk" required:"true" cty:"disk" hcl:"disk"`
+	Quiesce       *bool             `mapstructure:"quiesce" required:"false" cty:"quiesce" hcl:"quiesce"`
 }
 
 // FlatMapstructure returns a new FlatVolumeSource.
@@ -184,8 +285,10 @@ func (*VolumeSource) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.
 func (*FlatVolumeSource) HCL2Spec() map[string]hcldec.Spec {
 	s := map[string]hcldec.Spec{
 		"type":           &hcldec.AttrSpec{Name: "type", Type: cty.String, Required: false},
+		"verify_upload":  &hcldec.AttrSpec{Name: "verify_upload", Type: cty.String, Required: false},
 		"checksum":       &hcldec.AttrSpec{Name: "checksum", Type: cty.String, Required: false},
 		"urls":           &hcldec.AttrSpec{Name: "urls", Type: cty.List(cty.String), Required: false},
+		"fetch_on":       &hcldec.AttrSpec{Name: "fetch_on", Type: cty.String, Required: false},
 		"meta_data":      &hcldec.AttrSpec{Name: "meta_data", Type: cty.String, Required: false},
 		"user_data":      &hcldec.AttrSpec{Name: "user_data", Type: cty.String, Required: false},
 		"network_config": &hcldec.AttrSpec{Name: "network_config", Type: cty.String, Required: false},
@@ -195,6 +298,9 @@ func (*FlatVolumeSource) HCL2Spec() map[string]hcldec.Spec {
 		"files":          &hcldec.AttrSpec{Name: "files", Type: cty.List(cty.String), Required: false},
 		"contents":       &hcldec.AttrSpec{Name: "contents", Type: cty.Map(cty.String), Required: false},
 		"label":          &hcldec.AttrSpec{Name: "label", Type: cty.String, Required: false},
+		"domain":         &hcldec.AttrSpec{Name: "domain", Type: cty.String, Required: false},
+		"disk":           &hcldec.AttrSpec{Name: "disk", Type: cty.String, Required: false},
+		"quiesce":        &hcldec.AttrSpec{Name: "quiesce", Type: cty.Bool, Required: false},
 	}
 	return s
 }
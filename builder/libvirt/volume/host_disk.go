@@ -0,0 +1,59 @@
+package volume
+
+import (
+	"fmt"
+	"path"
+
+	"libvirt.org/go/libvirtxml"
+)
+
+// Ways a disk can be backed on the host
+const (
+	VolumeTypeVolume = "volume"
+	VolumeTypeFile   = "file"
+	VolumeTypeBlock  = "block"
+)
+
+// IsPoolVolume reports whether the disk is a volume of a libvirt storage pool. Only pool volumes are ever
+// created, deleted or reported as artifacts, files and block devices of the host are merely attached.
+func (v *Volume) IsPoolVolume() bool {
+	return v.Type == VolumeTypeVolume
+}
+
+// prepareHostDisk validates a disk attaching a file or a block device of the host
+func (v *Volume) prepareHostDisk() (errs []error) {
+	if v.Type != VolumeTypeFile && v.Type != VolumeTypeBlock {
+		return []error{fmt.Errorf("unknown volume type '%s', must be volume, file or block", v.Type)}
+	}
+
+	if v.Path == "" {
+		errs = append(errs, fmt.Errorf("path is required for %s volumes", v.Type))
+	} else if !path.IsAbs(v.Path) {
+		errs = append(errs, fmt.Errorf("path of %s volume must be absolute, got '%s'", v.Type, v.Path))
+	}
+
+	if v.Name == "" {
+		v.Name = v.Path
+	}
+
+	if v.Pool != "" || v.Source != nil || v.Size != "" || v.Capacity != "" || v.Encryption != "" || v.UpdateInPlace || v.hasQcow2Features() {
+		errs = append(errs, fmt.Errorf("%s volume %s is only attached, it can't have a pool, source, size, capacity, encryption, qcow2 features or be updated in place", v.Type, v.Path))
+	}
+
+	v.allowUnspecifiedSize = true
+
+	return
+}
+
+func (v *Volume) updateHostDiskSource(domainDisk *libvirtxml.DomainDisk) {
+	switch v.Type {
+	case VolumeTypeFile:
+		domainDisk.Source = &libvirtxml.DomainDiskSource{
+			File: &libvirtxml.DomainDiskSourceFile{File: v.Path},
+		}
+	case VolumeTypeBlock:
+		domainDisk.Source = &libvirtxml.DomainDiskSource{
+			Block: &libvirtxml.DomainDiskSourceBlock{Dev: v.Path},
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package volume
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/rs/xid"
+	"libvirt.org/go/libvirtxml"
+)
+
+// createOverlay creates a qcow2 overlay on top of the reused volume. The domain writes into the overlay only,
+// so the original contents stay untouched until the overlay is committed at the end of a successful build.
+func (pctx *PreparationContext) createOverlay() error {
+	baseDef := pctx.VolumeDefinition
+	if baseDef == nil || baseDef.Target == nil {
+		return fmt.Errorf("volume definition has no target")
+	}
+
+	overlayDef := &libvirtxml.StorageVolume{
+		Name:     fmt.Sprintf("%s.packer-%s.qcow2", pctx.VolumeConfig.Name, xid.New()),
+		Capacity: baseDef.Capacity,
+		Target: &libvirtxml.StorageVolumeTarget{
+			Format: &libvirtxml.StorageVolumeTargetFormat{Type: "qcow2"},
+		},
+		BackingStore: &libvirtxml.StorageVolumeBackingStore{
+			Path:   baseDef.Target.Path,
+			Format: baseDef.Target.Format,
+		},
+	}
+
+	overlayXML, err := overlayDef.Marshal()
+	if err != nil {
+		return fmt.Errorf("CreateOverlay.Marshal: %s", err)
+	}
+
+	ref, err := pctx.Driver.StorageVolCreateXML(*pctx.PoolRef, overlayXML, 0)
+	if err != nil {
+		return fmt.Errorf("CreateOverlay.RPC: %s", err)
+	}
+
+	pctx.OverlayRef = &ref
+	return nil
+}
+
+// DomainDiskXml returns the disk definition of the volume, pointing to the overlay
+// instead of the volume itself if the volume is updated in place, and unlocking encrypted volumes.
+func (pctx *PreparationContext) DomainDiskXml() *libvirtxml.DomainDisk {
+	domainDisk := pctx.VolumeConfig.DomainDiskXml()
+
+	if domainDisk != nil {
+		pctx.updateDomainDiskEncryption(domainDisk)
+	}
+
+	if domainDisk != nil && pctx.OverlayRef != nil {
+		domainDisk.Source.Volume.Volume = pctx.OverlayRef.Name
+		if domainDisk.Driver == nil {
+			domainDisk.Driver = &libvirtxml.DomainDiskDriver{}
+		}
+		domainDisk.Driver.Type = "qcow2"
+	}
+
+	return domainDisk
+}
+
+// CommitOverlay merges the overlay back into the updated volume with an active block commit.
+// The domain has to be running, but it may be paused.
+func (pctx *PreparationContext) CommitOverlay(ctx context.Context, domain libvirt.Domain) error {
+	disk := pctx.VolumeConfig.TargetDev
+
+	err := pctx.Driver.DomainBlockCommit(domain, disk, nil, nil, 0, libvirt.DomainBlockCommitActive)
+	if err != nil {
+		return fmt.Errorf("DomainBlockCommit: %s", err)
+	}
+
+	if err = waitForBlockJobReady(ctx, pctx.Driver, domain, disk); err != nil {
+		return err
+	}
+
+	err = pctx.Driver.DomainBlockJobAbort(domain, disk, libvirt.DomainBlockJobAbortPivot)
+	if err != nil {
+		return fmt.Errorf("DomainBlockJobAbort: %s", err)
+	}
+
+	pctx.OverlayIsCommitted = true
+	return nil
+}
+
+// DiscardOverlay deletes the overlay. Unless it was committed, every change made by the build is lost with it.
+func (pctx *PreparationContext) DiscardOverlay() error {
+	if pctx.OverlayRef == nil {
+		return nil
+	}
+
+	err := pctx.Driver.StorageVolDelete(*pctx.OverlayRef, libvirt.StorageVolDeleteNormal)
+	if err != nil {
+		return err
+	}
+
+	pctx.OverlayRef = nil
+	return nil
+}
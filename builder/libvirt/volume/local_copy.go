@@ -0,0 +1,124 @@
+package volume
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/digitalocean/go-libvirt"
+	"libvirt.org/go/libvirtxml"
+)
+
+// placeFileLocally copies the file at path straight into the directory of the target pool
+// and lets libvirt discover it with a pool refresh. This is only possible when the libvirt daemon
+// runs on the same machine and the pool is a directory pool. It returns false whenever the fast path
+// is not applicable or did not succeed, in which case the volume should be uploaded through libvirt.
+func (pctx *PreparationContext) placeFileLocally(path string) bool {
+	poolDef := pctx.PoolDefinition
+
+	if !pctx.LocalConnection || poolDef == nil || poolDef.Type != "dir" || poolDef.Target == nil || poolDef.Target.Path == "" {
+		return false
+	}
+
+	if pctx.VolumeDefinition.BackingStore != nil || filepath.Base(pctx.VolumeConfig.Name) != pctx.VolumeConfig.Name {
+		return false
+	}
+
+	target := filepath.Join(poolDef.Target.Path, pctx.VolumeConfig.Name)
+
+	if err := pctx.deleteReplacedVolume(); err != nil {
+		log.Printf("%s, falling back to upload\n", err)
+		return false
+	}
+
+	err := copyIntoPool(path, target, poolDef.Target.Permissions)
+	if err != nil {
+		log.Printf("Couldn't place '%s' directly into pool %s, falling back to upload: %s\n", path, pctx.VolumeConfig.Pool, err)
+		return false
+	}
+
+	err = pctx.Driver.StoragePoolRefresh(*pctx.PoolRef, 0)
+	if err == nil {
+		var ref libvirt.StorageVol
+		ref, err = pctx.Driver.StorageVolLookupByName(*pctx.PoolRef, pctx.VolumeConfig.Name)
+
+		if err == nil {
+			pctx.VolumeRef = &ref
+			pctx.VolumeIsCreated = true
+			pctx.Ui.Message(fmt.Sprintf("Copied '%s' directly into pool %s", path, pctx.VolumeConfig.Pool))
+			return true
+		}
+	}
+
+	log.Printf("Libvirt didn't pick up '%s' in pool %s, falling back to upload: %s\n", target, pctx.VolumeConfig.Pool, err)
+
+	if removeErr := os.Remove(target); removeErr != nil {
+		log.Printf("Couldn't remove '%s': %s\n", target, removeErr)
+	}
+	// Make libvirt forget about the removed file
+	pctx.Driver.StoragePoolRefresh(*pctx.PoolRef, 0)
+
+	return false
+}
+
+// copyIntoPool copies the file src to dst, which must not exist yet, and applies the
+// ownership and the permissions the pool defines for its volumes.
+func copyIntoPool(src string, dst string, perms *libvirtxml.StoragePoolTargetPermissions) (err error) {
+	mode := os.FileMode(0600)
+	uid, gid := -1, -1
+
+	if perms != nil {
+		if perms.Mode != "" {
+			m, err := strconv.ParseUint(perms.Mode, 8, 32)
+			if err != nil {
+				return fmt.Errorf("unknown permission mode '%s' on pool: %s", perms.Mode, err)
+			}
+			mode = os.FileMode(m)
+		}
+		if perms.Owner != "" {
+			if uid, err = strconv.Atoi(perms.Owner); err != nil {
+				return fmt.Errorf("unknown owner '%s' on pool: %s", perms.Owner, err)
+			}
+		}
+		if perms.Group != "" {
+			if gid, err = strconv.Atoi(perms.Group); err != nil {
+				return fmt.Errorf("unknown group '%s' on pool: %s", perms.Group, err)
+			}
+		}
+	}
+
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	dstFile, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		closeErr := dstFile.Close()
+		if err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(dst)
+		}
+	}()
+
+	if err = copyFileContents(dstFile, srcFile); err != nil {
+		return err
+	}
+
+	if uid != -1 || gid != -1 {
+		if err = dstFile.Chown(uid, gid); err != nil {
+			return err
+		}
+	}
+
+	return dstFile.Chmod(mode)
+}
@@ -0,0 +1,33 @@
+//go:build linux
+
+package volume
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// copyFileContents copies src into dst. It tries to reflink the file first, which shares the data blocks
+// on filesystems supporting it, then falls back to an in-kernel copy with copy_file_range.
+func copyFileContents(dst *os.File, src *os.File) error {
+	if err := unix.IoctlFileClone(int(dst.Fd()), int(src.Fd())); err == nil {
+		return nil
+	}
+
+	for {
+		n, err := unix.CopyFileRange(int(src.Fd()), nil, int(dst.Fd()), nil, 1<<30, 0)
+		if err != nil {
+			if errors.Is(err, unix.EXDEV) || errors.Is(err, unix.ENOSYS) || errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, unix.EINVAL) {
+				// Both file offsets have been advanced by the bytes already copied
+				_, err = io.Copy(dst, src)
+			}
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package volume
+
+import (
+	"io"
+	"os"
+)
+
+// copyFileContents copies src into dst.
+func copyFileContents(dst *os.File, src *os.File) error {
+	_, err := io.Copy(dst, src)
+	return err
+}
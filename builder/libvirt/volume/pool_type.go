@@ -0,0 +1,152 @@
+package volume
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	libvirtutils "github.com/thomasklein94/packer-plugin-libvirt/libvirt-utils"
+	"libvirt.org/go/libvirtxml"
+)
+
+// poolTypeSupport describes what a storage pool type can do with volumes.
+// See https://libvirt.org/storage.html for the details of each pool type.
+type poolTypeSupport struct {
+	// The volume formats the pool type can create. Empty means any format is accepted.
+	formats []string
+	// The format used for new volumes when none was requested. Empty means the pool's own default.
+	defaultFormat string
+	// Whether new volumes can be created in the pool at all.
+	createVolumes bool
+	// Whether a volume can be created as a copy of another volume.
+	cloning bool
+	// Whether a volume can use another volume as a qcow2 backing store.
+	backingStore bool
+}
+
+var fileBackedPoolSupport = poolTypeSupport{
+	createVolumes: true,
+	cloning:       true,
+	backingStore:  true,
+}
+
+var diskPartitionFormats = []string{"none", "linux", "fat16", "fat32", "linux-swap", "linux-lvm", "linux-raid", "extended"}
+
+var poolTypeSupports = map[string]poolTypeSupport{
+	"dir":      fileBackedPoolSupport,
+	"fs":       fileBackedPoolSupport,
+	"netfs":    fileBackedPoolSupport,
+	"gluster":  fileBackedPoolSupport,
+	"vstorage": fileBackedPoolSupport,
+	"logical": {
+		formats:       []string{"raw"},
+		defaultFormat: "raw",
+		createVolumes: true,
+		cloning:       true,
+	},
+	"zfs": {
+		formats:       []string{"raw"},
+		defaultFormat: "raw",
+		createVolumes: true,
+	},
+	"rbd": {
+		formats:       []string{"raw"},
+		defaultFormat: "raw",
+		createVolumes: true,
+		cloning:       true,
+	},
+	"disk": {
+		formats:       diskPartitionFormats,
+		createVolumes: true,
+		cloning:       true,
+	},
+	"iscsi":        {},
+	"iscsi-direct": {},
+	"scsi":         {},
+	"mpath":        {},
+}
+
+// Formats with raw content, which can be written into a pool creating raw volumes as they are.
+var rawContentFormats = []string{"raw", "iso"}
+
+func (support poolTypeSupport) acceptsFormat(format string) bool {
+	return len(support.formats) == 0 || libvirtutils.ContainsString(support.formats, format)
+}
+
+func (support poolTypeSupport) formatList() string {
+	if len(support.formats) == 0 {
+		return "any"
+	}
+	return strings.Join(support.formats, ", ")
+}
+
+// adaptToPool checks the volume against the capabilities of the pool's type and fills in
+// the default format of that pool type. The source of the volume is only checked if the volume is going
+// to be created. Unknown pool types are let through unchecked.
+func (v *Volume) adaptToPool(poolDef *libvirtxml.StoragePool, create bool) error {
+	support, ok := poolTypeSupports[poolDef.Type]
+	if !ok {
+		log.Printf("Unknown storage pool type '%s', skipping pool specific validation\n", poolDef.Type)
+		return nil
+	}
+
+	if create {
+		if err := poolCanCreateVolumes(poolDef); err != nil {
+			return err
+		}
+
+		if v.Source != nil {
+			switch v.Source.Type {
+			case "backing-store", "backingstore":
+				if !support.backingStore {
+					return fmt.Errorf("%s pools don't support backing stores, use a file based pool (dir, fs, netfs) or clone the volume instead", poolDef.Type)
+				}
+			case "cloning", "clone":
+				if !support.cloning {
+					return fmt.Errorf("%s pools don't support cloning volumes", poolDef.Type)
+				}
+			}
+		}
+	}
+
+	if v.Format == "" {
+		v.Format = support.defaultFormat
+	} else if !support.acceptsFormat(v.Format) {
+		return fmt.Errorf("format '%s' is not supported by %s pools, supported formats: %s", v.Format, poolDef.Type, support.formatList())
+	}
+
+	return nil
+}
+
+// adaptStorageDefinitionToPool replaces formats forced by volume sources with the default format of the pool type,
+// if the content of the volume allows it. For example, a cloud-init ISO can be stored in a raw logical volume.
+func adaptStorageDefinitionToPool(storageDef *libvirtxml.StorageVolume, poolDef *libvirtxml.StoragePool) error {
+	support, ok := poolTypeSupports[poolDef.Type]
+	if !ok || storageDef.Target == nil || storageDef.Target.Format == nil {
+		return nil
+	}
+
+	format := storageDef.Target.Format.Type
+	if support.acceptsFormat(format) {
+		return nil
+	}
+
+	if !libvirtutils.ContainsString(rawContentFormats, format) {
+		return fmt.Errorf("volume format '%s' is not supported by %s pools, supported formats: %s", format, poolDef.Type, support.formatList())
+	}
+
+	if support.defaultFormat == "" {
+		storageDef.Target.Format = nil
+	} else {
+		storageDef.Target.Format.Type = support.defaultFormat
+	}
+
+	return nil
+}
+
+func poolCanCreateVolumes(poolDef *libvirtxml.StoragePool) error {
+	if support, ok := poolTypeSupports[poolDef.Type]; ok && !support.createVolumes {
+		return fmt.Errorf("%s pools can't create new volumes, only already existing volumes can be used from them", poolDef.Type)
+	}
+	return nil
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/digitalocean/go-libvirt"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	libvirtutils "github.com/thomasklein94/packer-plugin-libvirt/libvirt-utils"
 	"libvirt.org/go/libvirtxml"
 )
 
@@ -20,9 +21,46 @@ type PreparationContext struct {
 	VolumeRef        *libvirt.StorageVol
 	VolumeDefinition *libvirtxml.StorageVolume
 	PoolRef          *libvirt.StoragePool
+	PoolDefinition   *libvirtxml.StoragePool
 	VolumeIsCreated  bool
+	// True if an already existing volume is used as it is
+	VolumeIsReused   bool
 	VolumeIsArtifact bool
 	Context          context.Context
+	// True if the libvirt daemon runs on the same machine as Packer and
+	// files can be placed directly into the directory of a storage pool.
+	LocalConnection bool
+	// Runs commands on the libvirt host, if libvirt is reached over SSH
+	RemoteShell libvirtutils.RemoteShell
+	// The overlay receiving the writes of the domain while a reused volume is updated in place
+	OverlayRef *libvirt.StorageVol
+	// True once the overlay has been committed into the volume
+	OverlayIsCommitted bool
+	// The secret holding the passphrase of an encrypted volume
+	EncryptionSecret *libvirt.Secret
+	// An already existing volume with the same name. It's only deleted right before this volume is created,
+	// so a source failing to fetch or assemble its content leaves it in place.
+	volumeToReplace *libvirt.StorageVol
+	// The error which halted the preparation of this volume, if any.
+	// Volumes can be prepared concurrently, so errors are kept per volume
+	// and collected into the state bag by the caller.
+	Error error
+}
+
+// deleteReplacedVolume deletes the existing volume replaced by this one, if any.
+// From here on a failing preparation loses the existing volume.
+func (pctx *PreparationContext) deleteReplacedVolume() error {
+	if pctx.volumeToReplace == nil {
+		return nil
+	}
+
+	pctx.Ui.Message(fmt.Sprintf("Deleting existing volume %s/%s to replace it", pctx.VolumeConfig.Pool, pctx.VolumeConfig.Name))
+	if err := pctx.Driver.StorageVolDelete(*pctx.volumeToReplace, libvirt.StorageVolDeleteNormal); err != nil {
+		return fmt.Errorf("error while deleting volume %s/%s to replace it: %s", pctx.VolumeConfig.Pool, pctx.VolumeConfig.Name, err)
+	}
+	pctx.volumeToReplace = nil
+
+	return nil
 }
 
 func (pctx *PreparationContext) CreateVolume() error {
@@ -30,6 +68,10 @@ func (pctx *PreparationContext) CreateVolume() error {
 		return fmt.Errorf("CreateVolume: Volume already exists")
 	}
 
+	if err := pctx.deleteReplacedVolume(); err != nil {
+		return err
+	}
+
 	volumeXML, err := pctx.VolumeDefinition.Marshal()
 	if err != nil {
 		return fmt.Errorf("CreateVolume.Marshal: %s", err)
@@ -39,7 +81,7 @@ func (pctx *PreparationContext) CreateVolume() error {
 		log.Printf("Volume definition XML:\n%s\n", volumeXML)
 	}
 
-	ref, err := pctx.Driver.StorageVolCreateXML(*pctx.PoolRef, volumeXML, 0)
+	ref, err := pctx.Driver.StorageVolCreateXML(*pctx.PoolRef, volumeXML, pctx.VolumeConfig.createFlags())
 	if err != nil {
 		return fmt.Errorf("CreateVolume.RPC: %s", err)
 	}
@@ -50,7 +92,7 @@ func (pctx *PreparationContext) CreateVolume() error {
 	return nil
 }
 
-func (pctx *PreparationContext) CloneVolumeFrom(sourcePool libvirt.StoragePool, sourceVol libvirt.StorageVol) error {
+func (pctx *PreparationContext) CloneVolumeFrom(sourceVol libvirt.StorageVol) error {
 	if pctx.VolumeRef != nil {
 		return fmt.Errorf("CreateVolumeFrom: Volume already exists")
 	}
@@ -59,12 +101,16 @@ func (pctx *PreparationContext) CloneVolumeFrom(sourcePool libvirt.StoragePool,
 		return fmt.Errorf("can't simultaneously clone a volume and use a backing store")
 	}
 
+	if err := pctx.deleteReplacedVolume(); err != nil {
+		return err
+	}
+
 	volumeXML, err := pctx.VolumeDefinition.Marshal()
 	if err != nil {
 		return fmt.Errorf("CreateVolumeFrom.Marshal: %s", err)
 	}
 
-	ref, err := pctx.Driver.StorageVolCreateXMLFrom(sourcePool, volumeXML, sourceVol, 0)
+	ref, err := pctx.Driver.StorageVolCreateXMLFrom(*pctx.PoolRef, volumeXML, sourceVol, pctx.VolumeConfig.createFlags())
 	if err != nil {
 		return fmt.Errorf("CreateVolumeFrom.RPC: %s", err)
 	}
@@ -93,17 +139,9 @@ func (pctx *PreparationContext) RefreshVolumeDefinition() error {
 }
 
 func (pctx *PreparationContext) uploadVolume(path string) multistep.StepAction {
-
-	fPtr, err := os.Open(path)
-	if err != nil {
-		pctx.HaltOnError(err, "UploadVolume.Open: %s", err)
-	}
-
-	defer fPtr.Close()
-
-	fInfo, err := fPtr.Stat()
+	fInfo, err := os.Stat(path)
 	if err != nil {
-		pctx.HaltOnError(err, "UploadVolume.Stat: %s", err)
+		return pctx.HaltOnError(err, "UploadVolume.Stat: %s", err)
 	}
 
 	size := uint64(fInfo.Size())
@@ -114,21 +152,53 @@ func (pctx *PreparationContext) uploadVolume(path string) multistep.StepAction {
 	// If omitted when creating a volume, the volume will be fully allocated at time of creation.
 	pctx.VolumeDefinition.Allocation = nil
 
+	err = pctx.transferFile(path, 0)
+	if err != nil {
+		return pctx.HaltOnError(err, "UploadVolume: %s", err)
+	}
+
+	return multistep.ActionContinue
+}
+
+// transferFile creates the volume with the contents of the local file found at path.
+// If the libvirt daemon is local and the pool is a directory pool, the file is copied directly
+// into the pool, otherwise it is created and streamed through libvirt.
+func (pctx *PreparationContext) transferFile(path string, uploadFlags libvirt.StorageVolUploadFlags) error {
+	if pctx.placeFileLocally(path) {
+		if err := pctx.RefreshVolumeDefinition(); err != nil {
+			log.Printf("Error while refreshing volume definition: %s\n", err)
+		}
+		return pctx.verifyTransfer(path)
+	}
+
+	fPtr, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("Open: %s", err)
+	}
+
+	defer fPtr.Close()
+
+	fInfo, err := fPtr.Stat()
+	if err != nil {
+		return fmt.Errorf("Stat: %s", err)
+	}
+
 	err = pctx.CreateVolume()
 	if err != nil {
-		return pctx.HaltOnError(err, "%s", err)
+		return err
 	}
 
-	err = pctx.Driver.StorageVolUpload(*pctx.VolumeRef, fPtr, 0, size, 0)
+	err = pctx.Driver.StorageVolUpload(*pctx.VolumeRef, fPtr, 0, uint64(fInfo.Size()), uploadFlags)
+	uploaded := err == nil
 
 	if err != nil {
 		connectUri, _ := pctx.Driver.ConnectGetUri()
 
 		// The test backend does not support Volume Uploads, so
 		if connectUri[0:4] == "test" {
-			pctx.Ui.Error(fmt.Sprintf("UploadVolume.Upload: %s", err))
+			pctx.Ui.Error(fmt.Sprintf("Error during volume streaming: %s", err))
 		} else {
-			return pctx.HaltOnError(err, "UploadVolume.Upload: %s", err)
+			return fmt.Errorf("Upload: %s", err)
 		}
 	}
 
@@ -138,12 +208,100 @@ func (pctx *PreparationContext) uploadVolume(path string) multistep.StepAction {
 		log.Printf("Error while refreshing volume definition: %s\n", err)
 	}
 
+	if !uploaded {
+		return nil
+	}
+
+	return pctx.verifyTransfer(path)
+}
+
+// verifyTransfer applies the verify_upload setting of the volume's source
+func (pctx *PreparationContext) verifyTransfer(path string) error {
+	if pctx.VolumeConfig.Source == nil {
+		return nil
+	}
+
+	if err := pctx.verifyUpload(path, pctx.VolumeConfig.Source.VerifyUpload); err != nil {
+		return fmt.Errorf("verification of volume %s/%s failed: %s", pctx.VolumeConfig.Pool, pctx.VolumeConfig.Name, err)
+	}
+
+	return nil
+}
+
+// resizeToCapacity grows the volume to the capacity requested in the volume configuration, if any.
+// Volumes are never shrunk, that would destroy the data at their end.
+func (pctx *PreparationContext) resizeToCapacity(storageTargetCapacity *libvirtxml.StorageVolumeSize) multistep.StepAction {
+	return pctx.resizeVolume(storageTargetCapacity, false)
+}
+
+// growToCapacity grows the volume to the requested capacity, but keeps its capacity if it's already larger
+func (pctx *PreparationContext) growToCapacity(storageTargetCapacity *libvirtxml.StorageVolumeSize) multistep.StepAction {
+	return pctx.resizeVolume(storageTargetCapacity, true)
+}
+
+func (pctx *PreparationContext) resizeVolume(storageTargetCapacity *libvirtxml.StorageVolumeSize, keepLarger bool) multistep.StepAction {
+	if storageTargetCapacity == nil {
+		return multistep.ActionContinue
+	}
+
+	multiplier, err := unitToMultiplier(storageTargetCapacity.Unit)
+	if err != nil {
+		return pctx.HaltOnError(err, "Error during volume resize: %s", err)
+	}
+	targetCapacityInBytes := storageTargetCapacity.Value * uint64(multiplier)
+
+	_, currentCapacity, _, err := pctx.Driver.StorageVolGetInfo(*pctx.VolumeRef)
+	if err != nil {
+		return pctx.HaltOnError(err, "Error during volume resize: %s", err)
+	}
+
+	resize, err := resizeNeeded(targetCapacityInBytes, currentCapacity, keepLarger)
+	if err != nil {
+		return pctx.HaltOnError(err, "Volume %s/%s %s", pctx.VolumeConfig.Pool, pctx.VolumeConfig.Name, err)
+	}
+	if !resize {
+		if targetCapacityInBytes < currentCapacity {
+			log.Printf("Volume %s/%s keeps its capacity of %d bytes instead of %d bytes\n", pctx.VolumeConfig.Pool, pctx.VolumeConfig.Name, currentCapacity, targetCapacityInBytes)
+		}
+		return multistep.ActionContinue
+	}
+
+	pctx.Ui.Message(fmt.Sprintf(
+		"Resizing volume %s/%s to meet capacity %d%s",
+		pctx.VolumeConfig.Pool,
+		pctx.VolumeConfig.Name,
+		storageTargetCapacity.Value,
+		storageTargetCapacity.Unit,
+	))
+
+	err = pctx.Driver.StorageVolResize(*pctx.VolumeRef, targetCapacityInBytes, 0)
+	if err != nil {
+		return pctx.HaltOnError(err, "Error during volume resize: %s", err)
+	}
+
+	if err = pctx.RefreshVolumeDefinition(); err != nil {
+		log.Printf("Error while refreshing volume definition: %s\n", err)
+	}
+
 	return multistep.ActionContinue
 }
 
+// resizeNeeded tells whether a volume of the current capacity has to be resized to the target capacity.
+// Shrinking is an error, unless the larger capacity is to be kept.
+func resizeNeeded(targetCapacity uint64, currentCapacity uint64, keepLarger bool) (bool, error) {
+	if targetCapacity < currentCapacity {
+		if keepLarger {
+			return false, nil
+		}
+		return false, fmt.Errorf("can't be shrunk from %d bytes to the requested capacity of %d bytes", currentCapacity, targetCapacity)
+	}
+
+	return targetCapacity > currentCapacity, nil
+}
+
 func (pctx *PreparationContext) HaltOnError(err error, s string, a ...interface{}) multistep.StepAction {
 	err2 := fmt.Errorf(s, a...)
-	pctx.State.Put("error", err2)
+	pctx.Error = err2
 	pctx.Ui.Error(err2.Error())
 	return multistep.ActionHalt
 }
@@ -0,0 +1,30 @@
+package volume
+
+import "testing"
+
+func TestResizeNeeded(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     uint64
+		current    uint64
+		keepLarger bool
+		resize     bool
+		fails      bool
+	}{
+		{name: "same capacity", target: 10, current: 10, resize: false},
+		{name: "grow", target: 20, current: 10, resize: true},
+		{name: "grow keeping larger", target: 20, current: 10, keepLarger: true, resize: true},
+		{name: "shrink", target: 5, current: 10, fails: true},
+		{name: "smaller clone keeps the capacity of its source", target: 5, current: 10, keepLarger: true, resize: false},
+	}
+
+	for _, tt := range tests {
+		resize, err := resizeNeeded(tt.target, tt.current, tt.keepLarger)
+		if (err != nil) != tt.fails {
+			t.Errorf("%s: expected failure %t, got %v", tt.name, tt.fails, err)
+		}
+		if resize != tt.resize {
+			t.Errorf("%s: expected resize %t, got %t", tt.name, tt.resize, resize)
+		}
+	}
+}
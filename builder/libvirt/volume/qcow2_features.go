@@ -0,0 +1,114 @@
+package volume
+
+import (
+	"fmt"
+
+	"github.com/digitalocean/go-libvirt"
+	libvirtutils "github.com/thomasklein94/packer-plugin-libvirt/libvirt-utils"
+	"libvirt.org/go/libvirtxml"
+)
+
+var qcow2CompatLevels = []string{"0.10", "1.1"}
+
+// hasQcow2Features reports whether any qcow2 specific creation setting is used
+func (v *Volume) hasQcow2Features() bool {
+	return v.Compat != "" || v.LazyRefcounts || v.ClusterSize != "" || v.Preallocation != ""
+}
+
+// prepareQcow2Features validates the qcow2 creation settings as far as it's possible before
+// the final format of the volume is known
+func (v *Volume) prepareQcow2Features() (errs []error) {
+	if !v.hasQcow2Features() {
+		return
+	}
+
+	if v.Source != nil {
+		switch v.Source.Type {
+		case "external", "cloud-init", "cloudinit", "files":
+			errs = append(errs, fmt.Errorf("compat, lazy_refcounts, cluster_size and preallocation can't be used for volume %s/%s, its %s source is uploaded as it is", v.Pool, v.Name, v.Source.Type))
+		}
+	}
+
+	if v.Format != "" && v.Format != "qcow2" {
+		errs = append(errs, fmt.Errorf("compat, lazy_refcounts, cluster_size and preallocation are only supported for qcow2 volumes, volume %s/%s is %s", v.Pool, v.Name, v.Format))
+	}
+
+	if v.Compat != "" && !libvirtutils.ContainsString(qcow2CompatLevels, v.Compat) {
+		errs = append(errs, fmt.Errorf("unknown compat '%s' for volume %s/%s, must be 0.10 or 1.1", v.Compat, v.Pool, v.Name))
+	}
+
+	if v.LazyRefcounts && v.Compat == "0.10" {
+		errs = append(errs, fmt.Errorf("lazy_refcounts requires compat 1.1 for volume %s/%s", v.Pool, v.Name))
+	}
+
+	if v.ClusterSize != "" {
+		size, err := bytesOf(v.ClusterSize)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("couldn't understand cluster_size '%s' of volume %s/%s: %s", v.ClusterSize, v.Pool, v.Name, err))
+		} else if size < 512 || size > 2*1024*1024 || size&(size-1) != 0 {
+			errs = append(errs, fmt.Errorf("cluster_size of volume %s/%s must be a power of two between 512B and 2MiB", v.Pool, v.Name))
+		}
+	}
+
+	switch v.Preallocation {
+	case "", "off", "metadata":
+	default:
+		errs = append(errs, fmt.Errorf("unknown preallocation '%s' for volume %s/%s, must be off or metadata", v.Preallocation, v.Pool, v.Name))
+	}
+
+	return
+}
+
+// inheritsSourceFormat reports whether the volume is created in the format of the volume it's copied from,
+// which is only known once the source is looked up
+func (v *Volume) inheritsSourceFormat() bool {
+	if v.Format != "" || v.Source == nil {
+		return false
+	}
+
+	switch v.Source.Type {
+	case "cloning", "clone", "domain":
+		return true
+	}
+	return false
+}
+
+// updateQcow2Features adds the qcow2 creation settings to the storage definition
+func (v *Volume) updateQcow2Features(storageDef *libvirtxml.StorageVolume) error {
+	if !v.hasQcow2Features() {
+		return nil
+	}
+
+	if storageDef.Target == nil || storageDef.Target.Format == nil || storageDef.Target.Format.Type != "qcow2" {
+		return fmt.Errorf("compat, lazy_refcounts, cluster_size and preallocation are only supported for qcow2 volumes, set format to qcow2")
+	}
+
+	storageDef.Target.Compat = v.Compat
+
+	if v.LazyRefcounts {
+		if storageDef.Target.Compat == "" {
+			storageDef.Target.Compat = "1.1"
+		}
+		storageDef.Target.Features = append(storageDef.Target.Features, libvirtxml.StorageVolumeTargetFeature{
+			LazyRefcounts: &struct{}{},
+		})
+	}
+
+	if v.ClusterSize != "" {
+		size, err := bytesOf(v.ClusterSize)
+		if err != nil {
+			return err
+		}
+		storageDef.Target.ClusterSize = &libvirtxml.StorageVolumeTargetClusterSize{Value: size, Unit: "B"}
+	}
+
+	return nil
+}
+
+// createFlags returns the flags for creating the volume through libvirt
+func (v *Volume) createFlags() libvirt.StorageVolCreateFlags {
+	if v.Preallocation == "metadata" {
+		return libvirt.StorageVolCreatePreallocMetadata
+	}
+	return 0
+}
@@ -0,0 +1,48 @@
+package volume_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+	"github.com/thomasklein94/packer-plugin-libvirt/builder/libvirt/volume"
+)
+
+func TestQcow2FeaturesRequireACreatedVolume(t *testing.T) {
+	tests := []struct {
+		name   string
+		source *volume.VolumeSource
+		format string
+		fails  bool
+	}{
+		{name: "empty volume", format: "qcow2"},
+		{name: "backing store", source: &volume.VolumeSource{Type: "backing-store", BackingStore: volume.BackingStoreVolumeSource{Pool: "default", Volume: "base.qcow2"}}},
+		{name: "clone without format", source: &volume.VolumeSource{Type: "cloning", CloningVolume: volume.CloningVolumeSource{Pool: "default", Volume: "base.qcow2"}}},
+		{name: "external", source: &volume.VolumeSource{Type: "external", External: volume.ExternalVolumeSource{Urls: []string{"https://example.com/disk.qcow2"}}}, fails: true},
+		{name: "files", source: &volume.VolumeSource{Type: "files", FilesSource: volume.FilesVolumeSource{Contents: map[string]string{"a": "b"}}}, fails: true},
+	}
+
+	for _, tt := range tests {
+		vol := volume.Volume{
+			Name:        "disk.qcow2",
+			Pool:        "default",
+			Capacity:    "10G",
+			Format:      tt.format,
+			ClusterSize: "2MiB",
+			Source:      tt.source,
+		}
+
+		_, errs := vol.PrepareConfig(&interpolate.Context{}, "domain")
+
+		rejected := false
+		for _, err := range errs {
+			if strings.Contains(err.Error(), "cluster_size") {
+				rejected = true
+			}
+		}
+
+		if rejected != tt.fails {
+			t.Errorf("%s: expected rejection %t, got errors %v", tt.name, tt.fails, errs)
+		}
+	}
+}
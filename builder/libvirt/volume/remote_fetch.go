@@ -0,0 +1,238 @@
+package volume
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+// How long removing a leftover file on the libvirt host may take
+const remoteCleanupTimeout = 30 * time.Second
+
+var checksumCommands = map[string]string{
+	"md5":    "md5sum",
+	"sha1":   "sha1sum",
+	"sha256": "sha256sum",
+	"sha512": "sha512sum",
+}
+
+// Checksum types by the length of their hex representation, for checksums given without a type
+var checksumTypesByLength = map[int]string{
+	32:  "md5",
+	40:  "sha1",
+	64:  "sha256",
+	128: "sha512",
+}
+
+// fetchOnHost downloads the image on the libvirt host straight into the directory of the pool, using
+// the SSH connection of libvirt, then lets libvirt discover it with a pool refresh. The URLs are tried in order,
+// the first one downloaded with a matching checksum is used.
+func (vs *ExternalVolumeSource) fetchOnHost(pctx *PreparationContext) multistep.StepAction {
+	poolDef := pctx.PoolDefinition
+	name := pctx.VolumeConfig.Name
+
+	if pctx.RemoteShell == nil {
+		return pctx.HaltOnError(nil, "Volume %s/%s: fetch_on = \"host\" requires libvirt to be reached over ssh", pctx.VolumeConfig.Pool, name)
+	}
+	if poolDef == nil || poolDef.Type != "dir" || poolDef.Target == nil || poolDef.Target.Path == "" {
+		return pctx.HaltOnError(nil, "Volume %s/%s: fetch_on = \"host\" requires a dir pool", pctx.VolumeConfig.Pool, name)
+	}
+	if filepath.Base(name) != name {
+		return pctx.HaltOnError(nil, "Volume %s/%s: fetch_on = \"host\" requires a plain file name as volume name", pctx.VolumeConfig.Pool, name)
+	}
+
+	target := path.Join(poolDef.Target.Path, name)
+	partial := path.Join(poolDef.Target.Path, fmt.Sprintf(".%s.packer-download", name))
+
+	// A volume being replaced is still in place until the download succeeded
+	if pctx.volumeToReplace == nil {
+		if _, err := pctx.RemoteShell.Run(pctx.Context, fmt.Sprintf("test ! -e %s", shellQuote(target))); err != nil {
+			return pctx.HaltOnError(err, "Volume %s/%s: %s already exists on the libvirt host", pctx.VolumeConfig.Pool, name, target)
+		}
+	}
+
+	defer removeOnHost(pctx, partial)
+
+	var err error
+	for _, u := range vs.Urls {
+		pctx.Ui.Message(fmt.Sprintf("Downloading %s on the libvirt host", u))
+
+		if err = vs.downloadOnHost(pctx, u, partial); err == nil {
+			break
+		}
+
+		pctx.Ui.Error(fmt.Sprintf("Error downloading %s on the libvirt host: %s", u, err))
+	}
+
+	if err != nil {
+		return pctx.HaltOnError(err, "Error while downloading volume %s/%s on the libvirt host: %s", pctx.VolumeConfig.Pool, name, err)
+	}
+
+	if err = pctx.deleteReplacedVolume(); err != nil {
+		return pctx.HaltOnError(err, "%s", err)
+	}
+
+	// Unlike mv -n, ln fails if something took the name in the meantime. The partial name is removed when we return.
+	if _, err = pctx.RemoteShell.Run(pctx.Context, fmt.Sprintf("ln %s %s", shellQuote(partial), shellQuote(target))); err != nil {
+		return pctx.HaltOnError(err, "Error while moving the download into pool %s, %s may already exist: %s", pctx.VolumeConfig.Pool, target, err)
+	}
+
+	if perms := poolDef.Target.Permissions; perms != nil {
+		if perms.Mode != "" {
+			if _, err = pctx.RemoteShell.Run(pctx.Context, fmt.Sprintf("chmod %s %s", shellQuote(perms.Mode), shellQuote(target))); err != nil {
+				log.Printf("Couldn't apply the mode of pool %s to %s: %s\n", pctx.VolumeConfig.Pool, target, err)
+			}
+		}
+		if perms.Owner != "" || perms.Group != "" {
+			if _, err = pctx.RemoteShell.Run(pctx.Context, fmt.Sprintf("chown %s:%s %s", shellQuote(perms.Owner), shellQuote(perms.Group), shellQuote(target))); err != nil {
+				log.Printf("Couldn't apply the ownership of pool %s to %s: %s\n", pctx.VolumeConfig.Pool, target, err)
+			}
+		}
+	}
+
+	var ref libvirt.StorageVol
+	err = pctx.Driver.StoragePoolRefresh(*pctx.PoolRef, 0)
+	if err == nil {
+		ref, err = pctx.Driver.StorageVolLookupByName(*pctx.PoolRef, name)
+	}
+
+	if err != nil {
+		removeOnHost(pctx, target)
+		pctx.Driver.StoragePoolRefresh(*pctx.PoolRef, 0)
+		return pctx.HaltOnError(err, "Libvirt didn't pick up the download in pool %s: %s", pctx.VolumeConfig.Pool, err)
+	}
+
+	pctx.VolumeRef = &ref
+	pctx.VolumeIsCreated = true
+
+	if err = pctx.RefreshVolumeDefinition(); err != nil {
+		log.Printf("Error while refreshing volume definition: %s\n", err)
+	}
+
+	return multistep.ActionContinue
+}
+
+// removeOnHost deletes a file on the libvirt host. It has its own deadline,
+// since it also cleans up after a cancelled build whose context is already done.
+func removeOnHost(pctx *PreparationContext, path string) {
+	ctx, cancel := context.WithTimeout(context.Background(), remoteCleanupTimeout)
+	defer cancel()
+
+	if _, err := pctx.RemoteShell.Run(ctx, fmt.Sprintf("rm -f %s", shellQuote(path))); err != nil {
+		log.Printf("Couldn't remove %s on the libvirt host: %s\n", path, err)
+	}
+}
+
+// downloadOnHost downloads a single URL into dst on the libvirt host and verifies its checksum
+func (vs *ExternalVolumeSource) downloadOnHost(pctx *PreparationContext, u string, dst string) error {
+	download := fmt.Sprintf(
+		"if command -v curl >/dev/null 2>&1; then curl -fsSL --retry 3 -o %[1]s %[2]s; else wget -q -O %[1]s %[2]s; fi",
+		shellQuote(dst),
+		shellQuote(u),
+	)
+
+	if _, err := pctx.RemoteShell.Run(pctx.Context, download); err != nil {
+		return err
+	}
+
+	checksumType, expected, err := vs.expectedChecksum(pctx, u)
+	if err != nil || checksumType == "" {
+		return err
+	}
+
+	output, err := pctx.RemoteShell.Run(pctx.Context, fmt.Sprintf("%s %s", checksumCommands[checksumType], shellQuote(dst)))
+	if err != nil {
+		return fmt.Errorf("error computing %s checksum: %s", checksumType, err)
+	}
+
+	fields := strings.Fields(output)
+	if len(fields) == 0 || !strings.EqualFold(fields[0], expected) {
+		got := ""
+		if len(fields) > 0 {
+			got = fields[0]
+		}
+		return fmt.Errorf("checksums didn't match. expected %s and got %s", expected, got)
+	}
+
+	return nil
+}
+
+// expectedChecksum understands the same checksum notations as downloads on the runner:
+// empty or `none` to skip verification, `<type>:<value>`, a bare value and `file:<url>` for checksum files.
+func (vs *ExternalVolumeSource) expectedChecksum(pctx *PreparationContext, u string) (checksumType string, value string, err error) {
+	if vs.Checksum == "" || vs.Checksum == "none" {
+		return "", "", nil
+	}
+
+	parts := strings.SplitN(vs.Checksum, ":", 2)
+	if len(parts) != 2 {
+		checksumType, ok := checksumTypesByLength[len(vs.Checksum)]
+		if !ok {
+			return "", "", fmt.Errorf("couldn't guess the type of checksum '%s', use <type>:<value>", vs.Checksum)
+		}
+		return checksumType, vs.Checksum, nil
+	}
+
+	if parts[0] != "file" {
+		if _, ok := checksumCommands[parts[0]]; !ok {
+			return "", "", fmt.Errorf("unsupported checksum type '%s'", parts[0])
+		}
+		return parts[0], parts[1], nil
+	}
+
+	output, err := pctx.RemoteShell.Run(pctx.Context, fmt.Sprintf(
+		"if command -v curl >/dev/null 2>&1; then curl -fsSL --retry 3 %[1]s; else wget -q -O - %[1]s; fi",
+		shellQuote(parts[1]),
+	))
+	if err != nil {
+		return "", "", fmt.Errorf("error downloading checksum file %s: %s", parts[1], err)
+	}
+
+	fileName := u
+	if parsed, err := url.Parse(u); err == nil {
+		fileName = parsed.Path
+	}
+
+	value, ok := checksumFromFile(output, path.Base(fileName))
+	if !ok {
+		return "", "", fmt.Errorf("no checksum found for %s in %s", path.Base(fileName), parts[1])
+	}
+
+	checksumType, ok = checksumTypesByLength[len(value)]
+	if !ok {
+		return "", "", fmt.Errorf("unknown checksum type of '%s' in %s", value, parts[1])
+	}
+
+	return checksumType, value, nil
+}
+
+// checksumFromFile finds the checksum of a file in GNU (`<sum>  <file>`) or BSD (`SHA256 (<file>) = <sum>`) format
+func checksumFromFile(contents string, fileName string) (string, bool) {
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if i := strings.Index(line, " ("+fileName+") = "); i >= 0 {
+			return strings.TrimSpace(line[i+len(fileName)+6:]), true
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 2 && strings.TrimPrefix(path.Base(strings.TrimPrefix(fields[1], "*")), "./") == fileName {
+			return fields[0], true
+		}
+	}
+	return "", false
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,90 @@
+package volume
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	tests := []string{
+		"",
+		"plain",
+		"with spaces  and\ttabs",
+		"it's quoted",
+		"'''",
+		`"double" quotes`,
+		"$(touch /tmp/pwned)",
+		"`id`",
+		"${HOME} $HOME",
+		"semi; colon && pipe | ampersand &",
+		"back\\slash\nnew line",
+		"https://example.com/image.qcow2?token=a&b='c'",
+	}
+
+	for _, s := range tests {
+		output, err := exec.Command("sh", "-c", "printf %s "+shellQuote(s)).Output()
+		if err != nil {
+			t.Fatalf("%q: the shell failed: %s", s, err)
+		}
+		if string(output) != s {
+			t.Errorf("%q: the shell saw %q", s, output)
+		}
+	}
+}
+
+func TestChecksumFromFile(t *testing.T) {
+	contents := `
+# comment
+d2a7ef6d0c4e9d2d8c8e0b3b2d6a3c7e1f7f9a0b2c4d6e8f0a1b3c5d7e9f1a2b  other.img
+aa11  *image.qcow2
+SHA256 (bsd.img) = bb22
+cc33  ./sub/nested.img
+`
+
+	tests := []struct {
+		fileName string
+		expected string
+		found    bool
+	}{
+		{"image.qcow2", "aa11", true},
+		{"bsd.img", "bb22", true},
+		{"nested.img", "cc33", true},
+		{"missing.img", "", false},
+		{"image", "", false},
+	}
+
+	for _, tt := range tests {
+		value, found := checksumFromFile(contents, tt.fileName)
+		if found != tt.found || value != tt.expected {
+			t.Errorf("%s: expected (%q, %t), got (%q, %t)", tt.fileName, tt.expected, tt.found, value, found)
+		}
+	}
+}
+
+// contextCheckingShell fails commands run with a context that is already done, like a real SSH session would
+type contextCheckingShell struct {
+	commands []string
+}
+
+func (s *contextCheckingShell) Run(ctx context.Context, command string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	s.commands = append(s.commands, command)
+	return "", nil
+}
+
+func TestRemoveOnHostAfterCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	shell := &contextCheckingShell{}
+	pctx := &PreparationContext{Context: ctx, RemoteShell: shell}
+
+	removeOnHost(pctx, "/var/lib/libvirt/images/.disk.qcow2.packer-download")
+
+	if len(shell.commands) != 1 || shell.commands[0] != "rm -f '/var/lib/libvirt/images/.disk.qcow2.packer-download'" {
+		t.Errorf("expected the partial download to be removed despite the cancelled build, ran %v", shell.commands)
+	}
+}
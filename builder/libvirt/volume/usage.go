@@ -0,0 +1,99 @@
+package volume
+
+import (
+	"fmt"
+
+	"github.com/digitalocean/go-libvirt"
+	"libvirt.org/go/libvirtxml"
+)
+
+// VolumeUsers lists the domains having the volume attached as a disk and the volumes using it as a backing store.
+// An empty result means the volume can be deleted without breaking anything libvirt knows about.
+func VolumeUsers(driver *libvirt.Libvirt, vol libvirt.StorageVol) ([]string, error) {
+	path, err := driver.StorageVolGetPath(vol)
+	if err != nil {
+		return nil, fmt.Errorf("StorageVolGetPath: %s", err)
+	}
+
+	users := []string{}
+
+	domains, _, err := driver.ConnectListAllDomains(1, 0)
+	if err != nil {
+		return nil, fmt.Errorf("ConnectListAllDomains: %s", err)
+	}
+
+	for _, domain := range domains {
+		rawDomainDef, err := driver.DomainGetXMLDesc(domain, libvirt.DomainXMLInactive)
+		if err != nil {
+			return nil, fmt.Errorf("DomainGetXMLDesc: %s", err)
+		}
+
+		domainDef := &libvirtxml.Domain{}
+		if err = domainDef.Unmarshal(rawDomainDef); err != nil {
+			return nil, fmt.Errorf("DomainUnmarshal: %s", err)
+		}
+
+		if domainDef.Devices == nil {
+			continue
+		}
+
+		for _, disk := range domainDef.Devices.Disks {
+			if diskUsesVolume(disk, vol, path) {
+				users = append(users, fmt.Sprintf("domain %s", domain.Name))
+				break
+			}
+		}
+	}
+
+	pools, _, err := driver.ConnectListAllStoragePools(1, libvirt.ConnectListStoragePoolsActive)
+	if err != nil {
+		return nil, fmt.Errorf("ConnectListAllStoragePools: %s", err)
+	}
+
+	for _, pool := range pools {
+		volumes, _, err := driver.StoragePoolListAllVolumes(pool, 1, 0)
+		if err != nil {
+			return nil, fmt.Errorf("StoragePoolListAllVolumes: %s", err)
+		}
+
+		for _, other := range volumes {
+			if other.Pool == vol.Pool && other.Name == vol.Name {
+				continue
+			}
+
+			rawVolumeDef, err := driver.StorageVolGetXMLDesc(other, 0)
+			if err != nil {
+				// The volume might have been deleted since listing
+				continue
+			}
+
+			volumeDef := &libvirtxml.StorageVolume{}
+			if err = volumeDef.Unmarshal(rawVolumeDef); err != nil {
+				return nil, fmt.Errorf("StorageVolUnmarshal: %s", err)
+			}
+
+			if volumeDef.BackingStore != nil && volumeDef.BackingStore.Path == path {
+				users = append(users, fmt.Sprintf("volume %s/%s", other.Pool, other.Name))
+			}
+		}
+	}
+
+	return users, nil
+}
+
+func diskUsesVolume(disk libvirtxml.DomainDisk, vol libvirt.StorageVol, path string) bool {
+	if disk.Source == nil {
+		return false
+	}
+
+	switch {
+	case disk.Source.Volume != nil:
+		return disk.Source.Volume.Pool == vol.Pool && disk.Source.Volume.Volume == vol.Name
+	case disk.Source.File != nil:
+		return disk.Source.File.File == path
+	case disk.Source.Block != nil:
+		return disk.Source.Block.Dev == path
+	}
+
+	return false
+}
@@ -0,0 +1,118 @@
+package volume
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Ways of checking the contents of a volume against the local file it was created from
+const (
+	VerifyUploadNone  = "none"
+	VerifyUploadQuick = "quick"
+	VerifyUploadFull  = "full"
+)
+
+// The size of the blocks compared at the beginning and the end of the volume by a quick verification
+const verifyBlockSize = 1024 * 1024
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n uint64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += uint64(n)
+	return n, err
+}
+
+// verifyUpload reads the volume back from libvirt and compares it with the local file at path.
+// A `full` verification compares the SHA-256 hash of the whole file, a `quick` one only the length,
+// the first and the last block. Only the first len(file) bytes of the volume are compared, since volumes
+// of some pools are rounded up to their allocation unit.
+func (pctx *PreparationContext) verifyUpload(path string, mode string) error {
+	if mode == "" || mode == VerifyUploadNone {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fInfo, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	size := uint64(fInfo.Size())
+	if size == 0 {
+		return nil
+	}
+
+	pctx.Ui.Message(fmt.Sprintf("Verifying the contents of volume %s/%s (%s)", pctx.VolumeConfig.Pool, pctx.VolumeConfig.Name, mode))
+
+	if mode == VerifyUploadFull {
+		localHash := sha256.New()
+		if _, err = io.Copy(localHash, f); err != nil {
+			return fmt.Errorf("error hashing %s: %s", path, err)
+		}
+
+		remoteHash := sha256.New()
+		counter := &countingWriter{w: remoteHash}
+		if err = pctx.Driver.StorageVolDownload(*pctx.VolumeRef, counter, 0, size, 0); err != nil {
+			return fmt.Errorf("error downloading the volume: %s", err)
+		}
+
+		if counter.n != size {
+			return fmt.Errorf("volume is %d bytes long instead of %d bytes", counter.n, size)
+		}
+
+		local, remote := hex.EncodeToString(localHash.Sum(nil)), hex.EncodeToString(remoteHash.Sum(nil))
+		if local != remote {
+			return fmt.Errorf("volume has the SHA-256 hash %s instead of %s", remote, local)
+		}
+
+		return nil
+	}
+
+	offsets, blockSize := quickVerifyBlocks(size)
+
+	for _, offset := range offsets {
+		local := make([]byte, blockSize)
+		if _, err = f.ReadAt(local, int64(offset)); err != nil {
+			return fmt.Errorf("error reading %s: %s", path, err)
+		}
+
+		remote := &bytes.Buffer{}
+		if err = pctx.Driver.StorageVolDownload(*pctx.VolumeRef, remote, offset, blockSize, 0); err != nil {
+			return fmt.Errorf("error downloading the volume: %s", err)
+		}
+
+		if uint64(remote.Len()) != blockSize {
+			return fmt.Errorf("volume is shorter than %d bytes", size)
+		}
+
+		if !bytes.Equal(local, remote.Bytes()) {
+			return fmt.Errorf("volume differs from %s in the block at offset %d", path, offset)
+		}
+	}
+
+	return nil
+}
+
+// quickVerifyBlocks returns the offsets and the size of the blocks a quick verification compares:
+// the first and the last block, or the whole file once if it's not longer than a block.
+func quickVerifyBlocks(size uint64) (offsets []uint64, blockSize uint64) {
+	if size <= verifyBlockSize {
+		return []uint64{0}, size
+	}
+
+	return []uint64{0, size - verifyBlockSize}, verifyBlockSize
+}
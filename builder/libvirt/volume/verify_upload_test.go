@@ -0,0 +1,99 @@
+package volume
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestQuickVerifyBlocks(t *testing.T) {
+	tests := []struct {
+		size      uint64
+		offsets   []uint64
+		blockSize uint64
+	}{
+		{1, []uint64{0}, 1},
+		{verifyBlockSize - 1, []uint64{0}, verifyBlockSize - 1},
+		{verifyBlockSize, []uint64{0}, verifyBlockSize},
+		{verifyBlockSize + 1, []uint64{0, 1}, verifyBlockSize},
+		{10 * verifyBlockSize, []uint64{0, 9 * verifyBlockSize}, verifyBlockSize},
+	}
+
+	for _, tt := range tests {
+		offsets, blockSize := quickVerifyBlocks(tt.size)
+		if fmt.Sprint(offsets) != fmt.Sprint(tt.offsets) || blockSize != tt.blockSize {
+			t.Errorf("size %d: expected %v with blocks of %d, got %v with blocks of %d", tt.size, tt.offsets, tt.blockSize, offsets, blockSize)
+		}
+	}
+}
+
+// fakeRemoteShell answers every command with the same output
+type fakeRemoteShell struct {
+	output   string
+	commands []string
+}
+
+func (s *fakeRemoteShell) Run(ctx context.Context, command string) (string, error) {
+	s.commands = append(s.commands, command)
+	return s.output, nil
+}
+
+func TestExpectedChecksum(t *testing.T) {
+	sha256Value := strings.Repeat("ab", 32)
+	md5Value := strings.Repeat("cd", 16)
+
+	tests := []struct {
+		checksum     string
+		url          string
+		shellOutput  string
+		checksumType string
+		value        string
+		fails        bool
+	}{
+		{checksum: "", checksumType: "", value: ""},
+		{checksum: "none", checksumType: "", value: ""},
+		{checksum: "sha256:" + sha256Value, checksumType: "sha256", value: sha256Value},
+		{checksum: sha256Value, checksumType: "sha256", value: sha256Value},
+		{checksum: md5Value, checksumType: "md5", value: md5Value},
+		{checksum: "abc", fails: true},
+		{checksum: "crc32:abcd", fails: true},
+		{
+			checksum:     "file:https://example.com/SHA256SUMS",
+			url:          "https://example.com/images/disk.qcow2?version=2",
+			shellOutput:  sha256Value + "  disk.qcow2\n" + md5Value + "  other.qcow2\n",
+			checksumType: "sha256",
+			value:        sha256Value,
+		},
+		{
+			checksum:    "file:https://example.com/SHA256SUMS",
+			url:         "https://example.com/images/missing.qcow2",
+			shellOutput: sha256Value + "  disk.qcow2\n",
+			fails:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		shell := &fakeRemoteShell{output: tt.shellOutput}
+		pctx := &PreparationContext{Context: context.Background(), RemoteShell: shell}
+		vs := &ExternalVolumeSource{Checksum: tt.checksum}
+
+		checksumType, value, err := vs.expectedChecksum(pctx, tt.url)
+		if tt.fails {
+			if err == nil {
+				t.Errorf("%q: expected an error", tt.checksum)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", tt.checksum, err)
+			continue
+		}
+		if checksumType != tt.checksumType || value != tt.value {
+			t.Errorf("%q: expected %s:%s, got %s:%s", tt.checksum, tt.checksumType, tt.value, checksumType, value)
+		}
+		if strings.HasPrefix(tt.checksum, "file:") && (len(shell.commands) != 1 || !strings.Contains(shell.commands[0], "'https://example.com/SHA256SUMS'")) {
+			t.Errorf("%q: expected the checksum file to be downloaded, ran %v", tt.checksum, shell.commands)
+		}
+	}
+}
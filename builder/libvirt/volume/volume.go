@@ -6,65 +6,13 @@ import (
 	"fmt"
 	"log"
 
+	"github.com/digitalocean/go-libvirt"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
 	"github.com/rs/xid"
 	"libvirt.org/go/libvirtxml"
 )
 
-var nextSerialLetter func() (string, error)
-var nextIdeLetter func() (string, error)
-var nextFloppyLetter func() (string, error)
-var nextVirtioLetter func() (string, error)
-
-func letterGenerator(prefix string, options string) func() (string, error) {
-	if len(options) == 0 {
-		panic("letterGenerator needs at least 1 option to work with")
-	}
-
-	var next = 0
-	return func() (string, error) {
-		if next >= len(options) {
-			return "", fmt.Errorf("device bus has used up all possible letters")
-		}
-		nextLetter := options[next]
-		next = next + 1
-
-		return prefix + string(nextLetter), nil
-	}
-}
-
-const asciiLower = "abcdefghijklmnopqrstuvwxyz"
-
-const scsiSataPrefix = "sd"
-const idePrefix = "hd"
-const floppyPrefix = "fd"
-const virtualPrefix = "vd"
-
-func ResetDeviceLetters() {
-	nextSerialLetter = letterGenerator(scsiSataPrefix, asciiLower)
-	nextIdeLetter = letterGenerator(idePrefix, asciiLower)
-	nextFloppyLetter = letterGenerator(floppyPrefix, "abcd")
-	nextVirtioLetter = letterGenerator(virtualPrefix, asciiLower)
-}
-
-func init() {
-	ResetDeviceLetters()
-}
-
-func nextDriveLetter(bus string) (string, error) {
-	switch bus {
-	case "fdc":
-		return nextFloppyLetter()
-	case "ide":
-		return nextIdeLetter()
-	case "virtio":
-		return nextVirtioLetter()
-	default:
-		return nextSerialLetter()
-	}
-}
-
 type Volume struct {
 	// Specifies the name of the storage pool (managed by libvirt) where the disk resides. If not specified
 	// the pool named `default` will be used
@@ -96,25 +44,95 @@ type Volume struct {
 	Capacity string `mapstructure:"capacity" required:"false"`
 	// If true, it indicates the device cannot be modified by the guest.
 	ReadOnly bool `mapstructure:"readonly" required:"false"`
-	// DEPRECATED!
-	// The device order on the bus is determined automatically from the order of definition
+	// The target device name of the disk on its bus, like `sdb` or `vdc`. If not set, the first free name of the bus
+	// is used, following the order of the volume blocks, which continues with `sdaa` after `sdz`.
+	// Explicitly set names are never handed out to other volumes.
 	TargetDev string `mapstructure:"target_dev" required:"false"`
 	// The optional bus attribute specifies the type of disk device to emulate;
 	// possible values are driver specific, with typical values being
-	// `ide`, `scsi`, `virtio`, `xen`, `usb`, `sata`, or `sd` `sd` since 1.1.2.
+	// `ide`, `scsi`, `virtio`, `xen`, `usb`, `sata`, `nvme` or `sd` `sd` since 1.1.2.
+	// `nvme` and `usb` disks are only supported by QEMU domains. See [NVMe and USB disks](#nvme-and-usb-disks).
 	// If omitted, the bus type is inferred from the style of the device name
 	// (e.g. a device named 'sda' will typically be exported using a SCSI bus).
 	Bus string `mapstructure:"bus" required:"false"`
+	// The position of the disk in the boot order of the domain, starting from 1. Can't be combined with `boot_devices`.
+	// See [Boot order](#boot-order).
+	BootOrder uint `mapstructure:"boot_order" required:"false"`
+	// Show a `usb` disk to the guest as removable media, like a USB stick.
+	Removable bool `mapstructure:"removable" required:"false"`
+	// The index of the controller the disk is attached to, among the controllers of its bus (`scsi`, `sata`, `ide`).
+	// If not set, the controllers of the bus are filled up in order. See [Disk controllers](#disk-controllers).
+	Controller *int `mapstructure:"controller" required:"false"`
 	// To help users identifying devices they care about, every device can have an alias which must be unique within the domain.
 	// Additionally, the identifier must consist only of the following characters: `[a-zA-Z0-9_-]`.
 	Alias string `mapstructure:"alias" required:"false"`
 	// Specifies the volume format type, like `qcow`, `qcow2`, `vmdk`, `raw`. If omitted, the storage pool's default format
-	// will be used.
+	// will be used. Block based pools (`logical`, `zfs` and `rbd`) only support and default to `raw`.
 	Format string `mapstructure:"format" required:"false"`
 	// Specifies the device type. If omitted, defaults to "disk". Can be `disk`, `floppy`, `cdrom` or `lun`.
 	Device string `mapstructure:"device" required:"false"`
+	// How the disk is backed on the host: `volume` (the default) for a volume of a libvirt storage pool,
+	// `file` for a plain file and `block` for a block device outside of any pool, like `/dev/mapper/vg-data`.
+	// See [Host files and block devices](#host-files-and-block-devices).
+	Type string `mapstructure:"type" required:"false"`
+	// The path of the file or block device on the libvirt host. Required for the `file` and `block` types.
+	Path string `mapstructure:"path" required:"false"`
+	// What to do when a volume with the same name already exists in the pool. Can be
+	// `fail` to stop the build, `replace` to delete the existing volume and create a new one in its place,
+	// `reuse` to use the existing volume as it is (ignoring the source) or `rename` to create the volume
+	// with a new, unused name. A volume is only replaced if no domain has it attached and no other volume
+	// uses it as a backing store. It's deleted once the source has been fetched or assembled, right before the new
+	// volume is created, so if the creation or the upload fails after that, the existing volume is lost.
+	// Volumes other volumes of the build are derived from can't be renamed.
+	// Defaults to `reuse` for volumes without a source and to `fail` for every other volume.
+	OnConflict string `mapstructure:"on_conflict" required:"false"`
+	// Update an existing volume in place instead of creating a new one. The domain writes into a temporary
+	// qcow2 overlay on top of the volume, which is committed into the volume once the build succeeded and
+	// discarded otherwise, leaving the original contents untouched. Only volumes without a source can be
+	// updated in place, the volume must already exist and its pool has to support backing stores.
+	// See [Updating a volume in place](#updating-a-volume-in-place).
+	UpdateInPlace bool `mapstructure:"update_in_place" required:"false"`
+
+	// The cache mode of the disk: `default`, `none`, `writethrough`, `writeback`, `directsync` or `unsafe`.
+	// `unsafe` ignores flushes from the guest, which speeds up throwaway installs, but loses data if the host crashes.
+	Cache string `mapstructure:"cache" required:"false"`
+	// The I/O mode of the disk: `threads`, `native` or `io_uring`. `native` requires `cache` to be `none` or `directsync`.
+	IO string `mapstructure:"io" required:"false"`
+	// Whether discard (trim) requests of the guest are passed to the volume (`unmap`) or not (`ignore`).
+	Discard string `mapstructure:"discard" required:"false"`
+	// Detect writes of zeroes and turn them into holes: `off`, `on` or `unmap`. `unmap` only has an effect together
+	// with `discard = "unmap"`.
+	DetectZeroes string `mapstructure:"detect_zeroes" required:"false"`
+	// Run the I/O of the disk in the given I/O thread, numbered from 1. The domain gets as many I/O threads
+	// as the highest number used by any volume. Only supported on the `virtio` bus.
+	IOThread uint `mapstructure:"iothread" required:"false"`
+	// A serial number reported to the guest, for example to get a stable `/dev/disk/by-id/` name.
+	Serial string `mapstructure:"serial" required:"false"`
+	// The qcow2 compatibility level of a new volume: `0.10` for very old QEMU versions or `1.1`.
+	Compat string `mapstructure:"compat" required:"false"`
+	// Enable lazy refcounts on a new qcow2 volume, which speeds up writes at the cost of a repair after a crash.
+	// Requires `compat` 1.1, which is used if `compat` is not set.
+	LazyRefcounts bool `mapstructure:"lazy_refcounts" required:"false"`
+	// The cluster size of a new qcow2 volume, a power of two between `512B` and `2MiB`, like `64KiB` or `2MiB`.
+	// Larger clusters speed up installs, smaller ones keep the artifact smaller.
+	ClusterSize string `mapstructure:"cluster_size" required:"false"`
+	// `metadata` preallocates the metadata of a new qcow2 volume, `off` (the default) creates it empty.
+	Preallocation string `mapstructure:"preallocation" required:"false"`
+	// Encrypt the new volume at rest. Only `luks` is supported, and only for volumes without a source.
+	Encryption string `mapstructure:"encryption" required:"false"`
+	// The passphrase of the encrypted volume, usually from a sensitive Packer variable.
+	// It's stored in an ephemeral, private libvirt secret for the duration of the build.
+	EncryptionPassphrase string `mapstructure:"encryption_passphrase" required:"false"`
+	// A World Wide Name reported to the guest, as 16 hexadecimal digits. Only supported on the `scsi` and `ide` buses.
+	WWN string `mapstructure:"wwn" required:"false"`
 
 	allowUnspecifiedSize bool `undocumented:"true"`
+	// The drive address of the disk on its controller, if its bus has one
+	address *libvirtxml.DomainAddress `undocumented:"true"`
+	// The file of a direct kernel boot the volume holds. Such volumes are not attached as disks.
+	bootFile string `undocumented:"true"`
+	// The part of a generated name that follows the domain name, empty when the name was set explicitly
+	nameSuffix string `undocumented:"true"`
 }
 
 func (v *Volume) PrepareConfig(ctx *interpolate.Context, domainName string) (warnings []string, errs []error) {
@@ -131,7 +149,17 @@ func (v *Volume) PrepareConfig(ctx *interpolate.Context, domainName string) (war
 		v.Alias = fmt.Sprintf("ua-%s", v.Alias)
 	}
 
-	if v.Pool == "" {
+	if v.Type == "" {
+		v.Type = VolumeTypeVolume
+	}
+
+	if !v.IsPoolVolume() {
+		errs = append(errs, v.prepareHostDisk()...)
+	} else if v.Path != "" {
+		errs = append(errs, fmt.Errorf("path can only be set for file and block volumes, volume %s/%s is a pool volume", v.Pool, v.Name))
+	}
+
+	if v.Pool == "" && v.IsPoolVolume() {
 		v.Pool = "default"
 		warnings = append(warnings, fmt.Sprintf("Pool isn't set for volume, using the '%s' pool", v.Pool))
 	}
@@ -145,20 +173,6 @@ func (v *Volume) PrepareConfig(ctx *interpolate.Context, domainName string) (war
 		warnings = append(warnings, fmt.Sprintf("Bus isn't set, using bus=%s as default", v.Bus))
 	}
 
-	targetDev, err := nextDriveLetter(v.Bus)
-	if v.TargetDev != "" {
-		warnings = append(warnings, fmt.Sprintf(`
-			Setting target_dev for volume is deprecated.
-			Order on the bus now determined by the order of the volume blocks!
-			Please remove the target_dev attribute from the volume definition!
-			Overriding target_dev='%s' to '%s'`, v.TargetDev, targetDev))
-	}
-
-	v.TargetDev = targetDev
-	if err != nil {
-		errs = append(errs, err)
-	}
-
 	if v.Source != nil {
 		w, e := v.Source.PrepareConfig(ctx, v, domainName)
 		warnings = append(warnings, w...)
@@ -171,10 +185,40 @@ func (v *Volume) PrepareConfig(ctx *interpolate.Context, domainName string) (war
 		if postfix == "" {
 			postfix = xid.New().String()
 		}
-		v.Name = fmt.Sprintf("%s-%s", domainName, postfix)
+		v.nameSuffix = postfix
+		v.Name = fmt.Sprintf("%s-%s", domainName, v.nameSuffix)
 		warnings = append(warnings, fmt.Sprintf("Volume name was not set, using '%s' as volume name instead.", v.Name))
 	}
 
+	if v.OnConflict == "" {
+		if v.Source == nil {
+			v.OnConflict = ConflictReuse
+		} else {
+			v.OnConflict = ConflictFail
+		}
+	}
+
+	switch v.OnConflict {
+	case ConflictFail, ConflictReplace, ConflictReuse, ConflictRename:
+	default:
+		errs = append(errs, fmt.Errorf("unknown on_conflict '%s' for volume %s/%s, must be one of fail, replace, reuse or rename", v.OnConflict, v.Pool, v.Name))
+	}
+
+	errs = append(errs, v.prepareBus()...)
+	errs = append(errs, v.prepareDriverTuning()...)
+	errs = append(errs, v.prepareQcow2Features()...)
+	errs = append(errs, v.prepareEncryption()...)
+
+	if v.UpdateInPlace {
+		if v.Source != nil {
+			errs = append(errs, fmt.Errorf("volume %s/%s has a source, only volumes without a source can be updated in place", v.Pool, v.Name))
+		}
+		if v.OnConflict != ConflictReuse {
+			errs = append(errs, fmt.Errorf("volume %s/%s is updated in place, its on_conflict must be reuse", v.Pool, v.Name))
+		}
+		v.allowUnspecifiedSize = true
+	}
+
 	if v.Size == "" && v.Capacity == "" && !v.allowUnspecifiedSize {
 		errs = append(errs, fmt.Errorf("at least one of Volume.Size or Volume.Capacity must be set for volume %s/%s", v.Pool, v.Name))
 	}
@@ -232,6 +276,10 @@ func (v *Volume) StorageDefinitionXml() (*libvirtxml.StorageVolume, error) {
 }
 
 func (v *Volume) DomainDiskXml() *libvirtxml.DomainDisk {
+	if v.bootFile != "" {
+		return nil
+	}
+
 	domainDisk := &libvirtxml.DomainDisk{
 		Device: v.Device,
 		Source: &libvirtxml.DomainDiskSource{
@@ -242,6 +290,10 @@ func (v *Volume) DomainDiskXml() *libvirtxml.DomainDisk {
 		},
 	}
 
+	if !v.IsPoolVolume() {
+		v.updateHostDiskSource(domainDisk)
+	}
+
 	if v.Alias != "" {
 		domainDisk.Alias = &libvirtxml.DomainAlias{
 			Name: v.Alias,
@@ -253,6 +305,9 @@ func (v *Volume) DomainDiskXml() *libvirtxml.DomainDisk {
 			domainDisk.Target = &libvirtxml.DomainDiskTarget{}
 		}
 		domainDisk.Target.Bus = v.Bus
+		if v.Removable {
+			domainDisk.Target.Removable = "on"
+		}
 	}
 
 	if v.TargetDev != "" {
@@ -262,9 +317,27 @@ func (v *Volume) DomainDiskXml() *libvirtxml.DomainDisk {
 		domainDisk.Target.Dev = v.TargetDev
 	}
 
-	if v.Format != "" {
-		domainDisk.Driver = &libvirtxml.DomainDiskDriver{}
-		domainDisk.Driver.Type = v.Format
+	domainDisk.Address = v.address
+
+	if v.Format != "" || v.Cache != "" || v.IO != "" || v.Discard != "" || v.DetectZeroes != "" || v.IOThread != 0 {
+		domainDisk.Driver = &libvirtxml.DomainDiskDriver{
+			Type:        v.Format,
+			Cache:       v.Cache,
+			IO:          v.IO,
+			Discard:     v.Discard,
+			DetectZeros: v.DetectZeroes,
+		}
+		if v.IOThread != 0 {
+			iothread := v.IOThread
+			domainDisk.Driver.IOThread = &iothread
+		}
+	}
+
+	domainDisk.Serial = v.Serial
+	domainDisk.WWN = v.WWN
+
+	if v.BootOrder != 0 {
+		domainDisk.Boot = &libvirtxml.DomainDeviceBoot{Order: v.BootOrder}
 	}
 
 	if v.ReadOnly {
@@ -277,40 +350,113 @@ func (v *Volume) DomainDiskXml() *libvirtxml.DomainDisk {
 	return domainDisk
 }
 
-func (v *Volume) PrepareVolume(pctx *PreparationContext) multistep.StepAction {
-	pctx.Ui.Message(fmt.Sprintf("Preparing volume %s/%s", v.Pool, v.Name))
-
+// ValidateAgainstPool looks up the storage pool of the volume, adapts the volume to the type of the pool
+// and checks whether the volume can be prepared there. It doesn't create anything, so every volume of
+// a build can be validated before any of them gets prepared.
+func (v *Volume) ValidateAgainstPool(pctx *PreparationContext) multistep.StepAction {
 	pctx.VolumeConfig = v
 
-	pool, err := pctx.Driver.StoragePoolLookupByName(pctx.VolumeConfig.Pool)
+	if !v.IsPoolVolume() {
+		return multistep.ActionContinue
+	}
+
+	pool, err := pctx.Driver.StoragePoolLookupByName(v.Pool)
 	if err != nil {
-		return pctx.HaltOnError(err, "Error while looking up storage pool %s: %s", pctx.VolumeConfig.Pool, err)
+		return pctx.HaltOnError(err, "Error while looking up storage pool %s: %s", v.Pool, err)
 	}
 	pctx.PoolRef = &pool
 
+	rawPoolDef, err := pctx.Driver.StoragePoolGetXMLDesc(pool, 0)
+	if err != nil {
+		return pctx.HaltOnError(err, "Error while getting the definition of storage pool %s: %s", v.Pool, err)
+	}
+
+	poolDef := &libvirtxml.StoragePool{}
+	if err = poolDef.Unmarshal(rawPoolDef); err != nil {
+		return pctx.HaltOnError(err, "Error while parsing the definition of storage pool %s: %s", v.Pool, err)
+	}
+	pctx.PoolDefinition = poolDef
+
+	if action := v.resolveConflict(pctx); action != multistep.ActionContinue {
+		return action
+	}
+
+	if pctx.VolumeIsReused && v.Encryption != "" {
+		return pctx.HaltOnError(nil, "Volume %s/%s already exists, an existing volume can't be encrypted", v.Pool, v.Name)
+	}
+
+	if err = v.adaptToPool(poolDef, pctx.VolumeRef == nil); err != nil {
+		return pctx.HaltOnError(err, "Volume %s/%s: %s", v.Pool, v.Name, err)
+	}
+
+	if support, ok := poolTypeSupports[poolDef.Type]; v.UpdateInPlace && ok && !support.backingStore {
+		return pctx.HaltOnError(nil, "Volume %s/%s can't be updated in place, %s pools don't support backing stores", v.Pool, v.Name, poolDef.Type)
+	}
+
 	volumeDef, err := v.StorageDefinitionXml()
 	if err != nil {
 		return pctx.HaltOnError(err, "Couldn't produce volume definition XML for %s/%s: %s", v.Pool, v.Name, err)
 	}
 
+	if err = adaptStorageDefinitionToPool(volumeDef, poolDef); err != nil {
+		return pctx.HaltOnError(err, "Volume %s/%s: %s", v.Pool, v.Name, err)
+	}
+
+	// Copies get their qcow2 settings once the format of their source is known
+	if !v.inheritsSourceFormat() {
+		if err = v.updateQcow2Features(volumeDef); err != nil && pctx.VolumeRef == nil {
+			return pctx.HaltOnError(err, "Volume %s/%s: %s", v.Pool, v.Name, err)
+		}
+	}
+
 	pctx.VolumeDefinition = volumeDef
 
-	if pctx.VolumeConfig.Source == nil {
-		vol, err := pctx.Driver.StorageVolLookupByName(*pctx.PoolRef, pctx.VolumeConfig.Name)
+	return multistep.ActionContinue
+}
+
+func (v *Volume) PrepareVolume(pctx *PreparationContext) multistep.StepAction {
+	if !v.IsPoolVolume() {
+		pctx.Ui.Message(fmt.Sprintf("Attaching host %s %s", v.Type, v.Path))
+		return multistep.ActionContinue
+	}
+
+	pctx.Ui.Message(fmt.Sprintf("Preparing volume %s/%s", v.Pool, v.Name))
 
-		if err == nil {
-			pctx.VolumeRef = &vol
-			pctx.VolumeIsCreated = false
-		} else if !pctx.VolumeIsArtifact {
-			return pctx.HaltOnError(err, "Error while looking up volume %s/%s: %s", v.Pool, v.Name, err)
+	if pctx.VolumeDefinition == nil {
+		if action := v.ValidateAgainstPool(pctx); action != multistep.ActionContinue {
+			return action
 		}
-	} else {
+	}
+
+	if pctx.VolumeIsReused && v.UpdateInPlace {
+		pctx.Ui.Message(fmt.Sprintf("Creating an overlay to update volume %s/%s in place", v.Pool, v.Name))
+		if err := pctx.RefreshVolumeDefinition(); err != nil {
+			return pctx.HaltOnError(err, "Error while getting the definition of volume %s/%s: %s", v.Pool, v.Name, err)
+		}
+		if err := pctx.createOverlay(); err != nil {
+			return pctx.HaltOnError(err, "Error while creating an overlay for volume %s/%s: %s", v.Pool, v.Name, err)
+		}
+		return multistep.ActionContinue
+	}
+
+	if pctx.VolumeIsReused {
+		pctx.Ui.Message(fmt.Sprintf("Reusing existing volume %s/%s", v.Pool, v.Name))
+		return multistep.ActionContinue
+	}
+
+	if pctx.VolumeConfig.Source != nil {
 		action := pctx.VolumeConfig.Source.PrepareVolume(pctx)
 		if action != multistep.ActionContinue {
 			return action
 		}
 	}
 
+	if pctx.VolumeRef == nil && v.Encryption != "" {
+		if err := pctx.defineEncryptionSecret(); err != nil {
+			return pctx.HaltOnError(err, "Error while defining the encryption secret of volume %s/%s: %s", v.Pool, v.Name, err)
+		}
+	}
+
 	if pctx.VolumeRef == nil {
 		err := pctx.CreateVolume()
 		if err != nil {
@@ -321,6 +467,104 @@ func (v *Volume) PrepareVolume(pctx *PreparationContext) multistep.StepAction {
 	return multistep.ActionContinue
 }
 
+// PlannedSize estimates the capacity and the allocation in bytes this volume is going to take up in its pool.
+// Volumes not created by the build and tiny generated images are reported with zero,
+// volumes of unknown size with an error.
+func (v *Volume) PlannedSize(driver *libvirt.Libvirt) (capacity uint64, allocation uint64, err error) {
+	if !v.IsPoolVolume() {
+		return 0, 0, nil
+	}
+
+	if v.Source == nil {
+		if pool, err := driver.StoragePoolLookupByName(v.Pool); err == nil {
+			if _, err := driver.StorageVolLookupByName(pool, v.Name); err == nil {
+				return 0, 0, nil
+			}
+		}
+	}
+
+	if capacity, err = bytesOf(v.Capacity); err != nil {
+		return 0, 0, fmt.Errorf("couldn't understand volume capacity '%s': %s", v.Capacity, err)
+	}
+	if allocation, err = bytesOf(v.Size); err != nil {
+		return 0, 0, fmt.Errorf("couldn't understand volume size '%s': %s", v.Size, err)
+	}
+
+	if v.Source == nil {
+		return
+	}
+
+	switch v.Source.Type {
+	case "cloud-init", "cloudinit", "files":
+		return 0, 0, nil
+	case "external":
+		if v.Capacity != "" {
+			return
+		}
+		// The downloaded image is uploaded as it is, so it takes up its own size
+		size, err := v.Source.External.sourceSize()
+		if err != nil {
+			return 0, 0, err
+		}
+		return size, size, nil
+	case "domain":
+		if v.Capacity == "" {
+			return 0, 0, fmt.Errorf("the size of a domain's disk is only known when it's copied, set capacity to include it")
+		}
+	case "cloning", "clone", "backing-store", "backingstore":
+		if v.Capacity != "" {
+			return
+		}
+		sourcePoolName, sourceVolumeName := v.Source.referencedVolume()
+
+		sourcePool, err := driver.StoragePoolLookupByName(sourcePoolName)
+		if err != nil {
+			return 0, 0, fmt.Errorf("error while looking up storage pool %s: %s", sourcePoolName, err)
+		}
+		sourceVolume, err := driver.StorageVolLookupByName(sourcePool, sourceVolumeName)
+		if err != nil {
+			return 0, 0, fmt.Errorf("error while looking up volume %s/%s: %s", sourcePoolName, sourceVolumeName, err)
+		}
+		_, sourceCapacity, sourceAllocation, err := driver.StorageVolGetInfo(sourceVolume)
+		if err != nil {
+			return 0, 0, fmt.Errorf("error while getting info of volume %s/%s: %s", sourcePoolName, sourceVolumeName, err)
+		}
+
+		capacity = sourceCapacity
+		// A clone copies the data of its source, while an overlay starts empty
+		if v.Source.Type == "cloning" || v.Source.Type == "clone" {
+			allocation = sourceAllocation
+		}
+	}
+
+	return
+}
+
+// DependsOn reports whether the other volume has to be prepared before this one,
+// because this volume uses it as a backing store or as a cloning source.
+func (v *Volume) DependsOn(other *Volume) bool {
+	if v.Source == nil {
+		return false
+	}
+
+	pool, name := v.Source.referencedVolume()
+	return name != "" && pool == other.Pool && name == other.Name
+}
+
+// RenameDomain regenerates the name of a volume whose name was derived from the domain name,
+// so a domain renamed at build time doesn't end up using the volumes of the domain it collided with.
+// Volumes named explicitly are left alone.
+func (v *Volume) RenameDomain(domainName string) {
+	if v.nameSuffix != "" {
+		v.Name = fmt.Sprintf("%s-%s", domainName, v.nameSuffix)
+	}
+}
+
+// NameFromDomain tells whether the name of the volume was derived from the domain name
+func (v *Volume) NameFromDomain() bool {
+	return v.nameSuffix != ""
+}
+
 func fmtReadPostfixedValue(s string) (value uint64, unit string, err error) {
 	var n int
 	n, err = fmt.Sscanf(s, "%d%s", &value, &unit)
@@ -333,16 +577,36 @@ func fmtReadPostfixedValue(s string) (value uint64, unit string, err error) {
 	switch unit {
 	case "":
 		unit = "B"
-	case "k", "kb", "kB":
+	case "k", "kb", "kB", "K", "KB":
 		unit = "KiB"
 	case "M", "Mb", "MB":
 		unit = "MiB"
 	case "G", "Gb", "GB":
 		unit = "GiB"
+	case "T", "Tb", "TB":
+		unit = "TiB"
 	}
 	return
 }
 
+func bytesOf(s string) (uint64, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	value, unit, err := fmtReadPostfixedValue(s)
+	if err != nil {
+		return 0, err
+	}
+
+	multiplier, err := unitToMultiplier(unit)
+	if err != nil {
+		return 0, err
+	}
+
+	return value * uint64(multiplier), nil
+}
+
 func unitToMultiplier(unit string) (value int64, err error) {
 	switch unit {
 	case "B":
@@ -353,6 +617,8 @@ func unitToMultiplier(unit string) (value int64, err error) {
 		value = 1024 * 1024
 	case "GiB":
 		value = 1024 * 1024 * 1024
+	case "TiB":
+		value = 1024 * 1024 * 1024 * 1024
 	default:
 		err = fmt.Errorf("unknown unit %s", unit)
 	}
@@ -0,0 +1,50 @@
+package volume_test
+
+import (
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+	"github.com/thomasklein94/packer-plugin-libvirt/builder/libvirt/volume"
+)
+
+func TestRenameDomain(t *testing.T) {
+	tests := []struct {
+		name     string
+		volume   volume.Volume
+		expected string
+	}{
+		{
+			name:     "generated from alias",
+			volume:   volume.Volume{Alias: "disk", Capacity: "1G"},
+			expected: "renamed-1-ua-disk",
+		},
+		{
+			name:     "cloud-init",
+			volume:   volume.Volume{Source: &volume.VolumeSource{Type: "cloud-init"}},
+			expected: "renamed-1-cloudinit",
+		},
+		{
+			name:     "explicit",
+			volume:   volume.Volume{Name: "disk.qcow2", Capacity: "1G"},
+			expected: "disk.qcow2",
+		},
+		{
+			name:     "boot file",
+			volume:   volume.NewBootFileVolume("default", "renamed", volume.BootFileKernel, "https://example.com/vmlinuz"),
+			expected: "renamed-1-kernel",
+		},
+	}
+
+	for _, tt := range tests {
+		vol := tt.volume
+		vol.Pool = "default"
+		if _, errs := vol.PrepareConfig(&interpolate.Context{}, "renamed"); len(errs) > 0 {
+			t.Fatalf("%s: unexpected errors: %v", tt.name, errs)
+		}
+
+		vol.RenameDomain("renamed-1")
+		if vol.Name != tt.expected {
+			t.Errorf("%s: expected name %s, got %s", tt.name, tt.expected, vol.Name)
+		}
+	}
+}
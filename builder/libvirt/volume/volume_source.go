@@ -11,29 +11,51 @@ import (
 )
 
 type VolumeSource struct {
-	Type          string                   `mapstructure:"type" required:"true"`
+	Type string `mapstructure:"type" required:"true"`
+	// Read the volume back from libvirt after it was uploaded and compare it with the local file it was created from.
+	// `quick` compares the length, the first and the last MiB, `full` compares the SHA-256 hash of the whole file,
+	// which reads the whole volume back. Any mismatch fails the build. Only applies to `external`, `cloud-init` and
+	// `files` sources. Defaults to `none`.
+	VerifyUpload  string                   `mapstructure:"verify_upload" required:"false"`
 	External      ExternalVolumeSource     `mapstructure:",squash"`
 	CloudInit     CloudInitSource          `mapstructure:",squash"`
 	BackingStore  BackingStoreVolumeSource `mapstructure:",squash"`
 	CloningVolume CloningVolumeSource      `mapstructure:",squash"`
 	FilesSource   FilesVolumeSource        `mapstructure:",squash"`
+	DomainDisk    DomainDiskVolumeSource   `mapstructure:",squash"`
 }
 
 func (vs *VolumeSource) PrepareConfig(ctx *interpolate.Context, vol *Volume, domainName string) (warnings []string, errs []error) {
+	switch vs.VerifyUpload {
+	case "":
+		vs.VerifyUpload = VerifyUploadNone
+	case VerifyUploadNone, VerifyUploadQuick, VerifyUploadFull:
+	default:
+		errs = append(errs, fmt.Errorf("unknown verify_upload '%s', must be none, quick or full", vs.VerifyUpload))
+	}
+
+	var w []string
+	var e []error
+
 	switch vs.Type {
 	case "external":
-		return vs.External.PrepareConfig(ctx, vol)
+		w, e = vs.External.PrepareConfig(ctx, vol)
 	case "cloud-init", "cloudinit":
-		return vs.CloudInit.PrepareConfig(ctx, vol, domainName)
+		w, e = vs.CloudInit.PrepareConfig(ctx, vol, domainName)
 	case "backing-store", "backingstore":
-		return vs.BackingStore.PrepareConfig(ctx, vol)
+		w, e = vs.BackingStore.PrepareConfig(ctx, vol)
 	case "cloning", "clone":
-		return vs.CloningVolume.PrepareConfig(ctx, vol)
+		w, e = vs.CloningVolume.PrepareConfig(ctx, vol)
 	case "files":
-		return vs.FilesSource.PrepareConfig(ctx, vol)
+		w, e = vs.FilesSource.PrepareConfig(ctx, vol)
+	case "domain":
+		w, e = vs.DomainDisk.PrepareConfig(ctx, vol)
 	default:
-		errs = append(errs, fmt.Errorf("unsupported volume source type '%s'", vs.Type))
+		e = []error{fmt.Errorf("unsupported volume source type '%s'", vs.Type)}
 	}
+
+	warnings = append(warnings, w...)
+	errs = append(errs, e...)
 	return
 }
 
@@ -49,6 +71,8 @@ func (vs *VolumeSource) UpdateDomainDiskXml(domainDisk *libvirtxml.DomainDisk) {
 		vs.CloningVolume.UpdateDomainDiskXml(domainDisk)
 	case "files":
 		vs.FilesSource.UpdateDomainDiskXml(domainDisk)
+	case "domain":
+		vs.DomainDisk.UpdateDomainDiskXml(domainDisk)
 	}
 }
 
@@ -64,6 +88,8 @@ func (vs *VolumeSource) UpdateStorageDefinitionXml(storageDef *libvirtxml.Storag
 		vs.CloningVolume.UpdateStorageDefinitionXml(storageDef)
 	case "files":
 		vs.FilesSource.UpdateStorageDefinitionXml(storageDef)
+	case "domain":
+		vs.DomainDisk.UpdateStorageDefinitionXml(storageDef)
 	}
 }
 
@@ -79,6 +105,19 @@ func (vs *VolumeSource) PrepareVolume(pctx *PreparationContext) multistep.StepAc
 		return vs.CloningVolume.PrepareVolume(pctx)
 	case "files":
 		return vs.FilesSource.PrepareVolume(pctx)
+	case "domain":
+		return vs.DomainDisk.PrepareVolume(pctx)
 	}
 	return multistep.ActionContinue
 }
+
+// referencedVolume returns the pool and name of the libvirt volume this source is derived from, if any.
+func (vs *VolumeSource) referencedVolume() (pool string, name string) {
+	switch vs.Type {
+	case "backing-store", "backingstore":
+		return vs.BackingStore.Pool, vs.BackingStore.Volume
+	case "cloning", "clone":
+		return vs.CloningVolume.Pool, vs.CloningVolume.Volume
+	}
+	return "", ""
+}
@@ -34,9 +34,16 @@ func ConnectByUriString(libvirtUri string) (*libvirt.Libvirt, error) {
 }
 
 func ConnectByUri(uri LibvirtUri) (*libvirt.Libvirt, error) {
+	connection, _, err := Connect(uri)
+	return connection, err
+}
+
+// Connect connects to the libvirt daemon and also returns the dialer used for the connection,
+// which might provide further access to the remote host, like a RemoteShell.
+func Connect(uri LibvirtUri) (*libvirt.Libvirt, socket.Dialer, error) {
 	dialer, err := NewDialerFromLibvirtUri(uri)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	connection := libvirt.NewWithDialer(dialer)
@@ -49,5 +56,5 @@ func ConnectByUri(uri LibvirtUri) (*libvirt.Libvirt, error) {
 			err = fmt.Errorf("error while establishing connection with libvirt daemon: %s", err)
 		}
 	}
-	return connection, err
+	return connection, dialer, err
 }
@@ -144,6 +144,16 @@ func (uri *LibvirtUri) Name() (result string) {
 	return
 }
 
+// IsLocal reports whether the URI points to a libvirt daemon running on this very machine,
+// reached through its unix socket. In that case, the daemon and Packer share the same filesystem.
+func (uri *LibvirtUri) IsLocal() bool {
+	if uri.Driver == "test" {
+		return false
+	}
+
+	return (uri.Transport == "" || uri.Transport == "unix") && uri.Hostname == ""
+}
+
 func allMatchedRegexpGroups(re *regexp.Regexp, s string) map[string]string {
 	match := re.FindStringSubmatch(s)
 	result := make(map[string]string)
@@ -128,3 +128,28 @@ func TestValidTestUriUnmarshall(t *testing.T) {
 		}
 	}
 }
+
+func TestUriIsLocal(t *testing.T) {
+	expectations := map[string]bool{
+		"qemu:///system":  true,
+		"qemu:///session": true,
+		"qemu+unix:///system?socket=/tmp/libvirt-sock": true,
+		"qemu+ssh://someuser@somehost:8022/system":     false,
+		"qemu+tcp://somehost/system":                   false,
+		"qemu+tls://somehost/system?no_verify=1":       false,
+		"test:///default":                              false,
+	}
+
+	for raw, expected := range expectations {
+		parsed := libvirtutils.LibvirtUri{}
+		err := parsed.Unmarshal(raw)
+
+		if err != nil {
+			t.Fatalf("Unexpected error while unmarshalling '%s': %s", raw, err)
+		}
+
+		if parsed.IsLocal() != expected {
+			t.Fatalf("%s IsLocal() returned %t, expected %t", raw, parsed.IsLocal(), expected)
+		}
+	}
+}
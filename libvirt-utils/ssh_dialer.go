@@ -1,10 +1,13 @@
 package libvirtutils
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"strconv"
+	"strings"
 
 	"github.com/hashicorp/packer-plugin-sdk/pathing"
 	"golang.org/x/crypto/ssh"
@@ -28,6 +31,51 @@ func (dialer *SshDialer) Dial() (net.Conn, error) {
 	return client.Dial("unix", dialer.remoteUnixSocket)
 }
 
+// RemoteShell runs shell commands on the machine running the libvirt daemon
+type RemoteShell interface {
+	// Run runs the command and returns its standard output.
+	// A failing command returns an error including its standard error.
+	Run(ctx context.Context, command string) (string, error)
+}
+
+// Run runs the command over the SSH connection already used for libvirt
+func (dialer *SshDialer) Run(ctx context.Context, command string) (string, error) {
+	if dialer.sshClient == nil {
+		return "", fmt.Errorf("ssh connection is not established yet")
+	}
+
+	session, err := dialer.sshClient.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("error opening ssh session: %s", err)
+	}
+	defer session.Close()
+
+	var stdout, stderr bytes.Buffer
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Run(command)
+	}()
+
+	select {
+	case <-ctx.Done():
+		session.Signal(ssh.SIGKILL)
+		return "", ctx.Err()
+	case err = <-done:
+	}
+
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return stdout.String(), fmt.Errorf("%s: %s", err, msg)
+		}
+		return stdout.String(), err
+	}
+
+	return stdout.String(), nil
+}
+
 func NewSshDialer(uri LibvirtUri) (dialer *SshDialer, err error) {
 	dialer = &SshDialer{
 		sshConfig: &ssh.ClientConfig{
@@ -23,7 +23,7 @@ func DomainStateMeansStopped(state libvirt.DomainState) (res bool) {
 func PollDomainState(
 	ctx context.Context,
 	period time.Duration,
-	driver libvirt.Libvirt,
+	driver *libvirt.Libvirt,
 	domain libvirt.Domain,
 	result chan<- libvirt.DomainState,
 	errs chan<- error,
@@ -0,0 +1,11 @@
+package libvirtutils
+
+// ContainsString reports whether the slice contains the string
+func ContainsString(haystack []string, needle string) bool {
+	for _, s := range haystack {
+		if s == needle {
+			return true
+		}
+	}
+	return false
+}